@@ -0,0 +1,236 @@
+package cache
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/utils"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/kms"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// 由salt派生包装密钥时使用的salt
+	saltKeyProviderSalt = "secret_cache_key_provider"
+)
+
+// CacheKeyProvider 文件缓存数据密钥及完整性校验密钥的保护方式，密钥包装后与密文一同存储，仅凭缓存文件无法解密凭据或伪造完整性校验值
+type CacheKeyProvider interface {
+	// 初始化
+	Init() error
+
+	// 包装数据密钥
+	WrapKey(key []byte) ([]byte, error)
+
+	// 解包数据密钥
+	UnwrapKey(wrappedKey []byte) ([]byte, error)
+
+	// 关闭，释放资源
+	Close() error
+}
+
+// KmsCryptoClient KMS加解密接口，service包中的默认SecretManagerClient实现了该接口
+type KmsCryptoClient interface {
+	Encrypt(ctx context.Context, req *kms.EncryptRequest) (*kms.EncryptResponse, error)
+
+	Decrypt(ctx context.Context, req *kms.DecryptRequest) (*kms.DecryptResponse, error)
+}
+
+// MasterKeyCacheKeyProvider 使用本地主密钥包装数据密钥，主密钥为base64编码的32字节密钥
+type MasterKeyCacheKeyProvider struct {
+	// 主密钥所在环境变量名称
+	EnvName string
+	// 主密钥文件路径，EnvName为空时使用
+	FilePath string
+	// 关闭时清除主密钥，与进行中的包装及解包并发访问
+	masterKeyMtx sync.RWMutex
+	masterKey    []byte
+}
+
+// saltCacheKeyProvider 未配置主密钥时使用由salt派生的密钥包装数据密钥，只避免缓存文件被直接解密，知道salt即可解包
+type saltCacheKeyProvider struct {
+	MasterKeyCacheKeyProvider
+	salt string
+}
+
+// KmsCacheKeyProvider 使用KMS主密钥信封加密数据密钥
+type KmsCacheKeyProvider struct {
+	Client KmsCryptoClient
+	// KMS主密钥ID或别名
+	KeyId string
+	// 调用KMS超时时间，单位ms，小于等于0时不设置超时
+	TimeoutMills int64
+}
+
+// 从环境变量读取主密钥
+func NewEnvMasterKeyCacheKeyProvider(envName string) *MasterKeyCacheKeyProvider {
+	return &MasterKeyCacheKeyProvider{
+		EnvName: envName,
+	}
+}
+
+// 从文件读取主密钥
+func NewFileMasterKeyCacheKeyProvider(filePath string) *MasterKeyCacheKeyProvider {
+	return &MasterKeyCacheKeyProvider{
+		FilePath: filePath,
+	}
+}
+
+func newSaltCacheKeyProvider(salt string) *saltCacheKeyProvider {
+	return &saltCacheKeyProvider{
+		salt: salt,
+	}
+}
+
+func NewKmsCacheKeyProvider(client KmsCryptoClient, keyId string) *KmsCacheKeyProvider {
+	return &KmsCacheKeyProvider{
+		Client: client,
+		KeyId:  keyId,
+	}
+}
+
+func (mp *MasterKeyCacheKeyProvider) Init() error {
+	var encodedKey string
+	if mp.EnvName != "" {
+		value, ok := os.LookupEnv(mp.EnvName)
+		if !ok {
+			return errors.New(fmt.Sprintf("env [%s] for master key not found", mp.EnvName))
+		}
+		encodedKey = value
+	} else if mp.FilePath != "" {
+		data, err := ioutil.ReadFile(mp.FilePath)
+		if err != nil {
+			return err
+		}
+		encodedKey = string(data)
+	} else {
+		return errors.New("the argument envName or filePath must not be empty")
+	}
+	masterKey, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encodedKey))
+	if err != nil {
+		return err
+	}
+	if len(masterKey) != utils.RandomKeyLength {
+		return errors.New(fmt.Sprintf("invalid master key length:%d", len(masterKey)))
+	}
+	mp.setMasterKey(masterKey)
+	return nil
+}
+
+// 使用aes256-gcm包装，格式为:随机数|密文
+func (mp *MasterKeyCacheKeyProvider) WrapKey(key []byte) ([]byte, error) {
+	gcm, err := mp.newGcm()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, key, nil), nil
+}
+
+func (mp *MasterKeyCacheKeyProvider) UnwrapKey(wrappedKey []byte) ([]byte, error) {
+	gcm, err := mp.newGcm()
+	if err != nil {
+		return nil, err
+	}
+	if len(wrappedKey) < gcm.NonceSize() {
+		return nil, errors.New("invalid wrapped key")
+	}
+	return gcm.Open(nil, wrappedKey[:gcm.NonceSize()], wrappedKey[gcm.NonceSize():], nil)
+}
+
+func (mp *MasterKeyCacheKeyProvider) newGcm() (cipher.AEAD, error) {
+	mp.masterKeyMtx.RLock()
+	defer mp.masterKeyMtx.RUnlock()
+	if mp.masterKey == nil {
+		return nil, errors.New("master key is not initialized")
+	}
+	block, err := aes.NewCipher(mp.masterKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (mp *MasterKeyCacheKeyProvider) setMasterKey(masterKey []byte) {
+	mp.masterKeyMtx.Lock()
+	defer mp.masterKeyMtx.Unlock()
+	mp.masterKey = masterKey
+}
+
+func (mp *MasterKeyCacheKeyProvider) Close() error {
+	mp.setMasterKey(nil)
+	return nil
+}
+
+func (sp *saltCacheKeyProvider) Init() error {
+	if sp.salt == "" {
+		return errors.New("the argument salt must not be empty")
+	}
+	sp.setMasterKey(pbkdf2.Key([]byte(sp.salt), []byte(saltKeyProviderSalt), utils.IterationCount, utils.KeyLength, sha256.New))
+	return nil
+}
+
+func (kp *KmsCacheKeyProvider) Init() error {
+	if kp.Client == nil {
+		return errors.New("the argument client must not be nil")
+	}
+	if kp.KeyId == "" {
+		return errors.New("the argument keyId must not be empty")
+	}
+	return nil
+}
+
+// 包装后的数据密钥为KMS返回的CiphertextBlob
+func (kp *KmsCacheKeyProvider) WrapKey(key []byte) ([]byte, error) {
+	ctx, cancel := kp.newContext()
+	defer cancel()
+	req := kms.CreateEncryptRequest()
+	req.Scheme = "https"
+	req.KeyId = kp.KeyId
+	req.Plaintext = base64.StdEncoding.EncodeToString(key)
+	resp, err := kp.Client.Encrypt(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(resp.CiphertextBlob), nil
+}
+
+func (kp *KmsCacheKeyProvider) UnwrapKey(wrappedKey []byte) ([]byte, error) {
+	ctx, cancel := kp.newContext()
+	defer cancel()
+	req := kms.CreateDecryptRequest()
+	req.Scheme = "https"
+	req.CiphertextBlob = string(wrappedKey)
+	resp, err := kp.Client.Decrypt(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(resp.Plaintext)
+}
+
+func (kp *KmsCacheKeyProvider) newContext() (context.Context, context.CancelFunc) {
+	if kp.TimeoutMills > 0 {
+		return context.WithTimeout(context.Background(), time.Duration(kp.TimeoutMills)*time.Millisecond)
+	}
+	return context.WithCancel(context.Background())
+}
+
+func (kp *KmsCacheKeyProvider) Close() error {
+	return nil
+}
@@ -0,0 +1,180 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/utils"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/kms"
+	"github.com/stretchr/testify/assert"
+)
+
+const testMasterKeyEnv = "test_cache_master_key"
+
+// 模拟KMS加解密，密文为keyId与明文的拼接
+type fakeKmsCryptoClient struct {
+	encryptCount int
+	decryptCount int
+	schemes      []string
+}
+
+func (f *fakeKmsCryptoClient) Encrypt(ctx context.Context, req *kms.EncryptRequest) (*kms.EncryptResponse, error) {
+	f.encryptCount++
+	f.schemes = append(f.schemes, req.Scheme)
+	resp := kms.CreateEncryptResponse()
+	resp.KeyId = req.KeyId
+	resp.CiphertextBlob = req.KeyId + ":" + req.Plaintext
+	return resp, nil
+}
+
+func (f *fakeKmsCryptoClient) Decrypt(ctx context.Context, req *kms.DecryptRequest) (*kms.DecryptResponse, error) {
+	f.decryptCount++
+	f.schemes = append(f.schemes, req.Scheme)
+	parts := strings.SplitN(req.CiphertextBlob, ":", 2)
+	if len(parts) != 2 {
+		return nil, errors.New("invalid ciphertext blob")
+	}
+	resp := kms.CreateDecryptResponse()
+	resp.KeyId = parts[0]
+	resp.Plaintext = parts[1]
+	return resp, nil
+}
+
+func newMasterKey(t *testing.T) string {
+	masterKey := make([]byte, utils.RandomKeyLength)
+	_, err := rand.Read(masterKey)
+	assert.Nil(t, err)
+	return base64.StdEncoding.EncodeToString(masterKey)
+}
+
+func TestMasterKeyCacheKeyProvider_Init(t *testing.T) {
+	os.Setenv(testMasterKeyEnv, newMasterKey(t))
+	defer os.Unsetenv(testMasterKeyEnv)
+	assert.Nil(t, NewEnvMasterKeyCacheKeyProvider(testMasterKeyEnv).Init())
+	assert.NotNil(t, NewEnvMasterKeyCacheKeyProvider("test_cache_master_key_not_exist").Init())
+
+	keyFile, err := ioutil.TempFile("", "master_key")
+	assert.Nil(t, err)
+	defer os.Remove(keyFile.Name())
+	_, err = keyFile.WriteString(newMasterKey(t) + "\n")
+	assert.Nil(t, err)
+	assert.Nil(t, keyFile.Close())
+	assert.Nil(t, NewFileMasterKeyCacheKeyProvider(keyFile.Name()).Init())
+
+	// 主密钥长度不是32字节
+	assert.Nil(t, ioutil.WriteFile(keyFile.Name(), []byte(base64.StdEncoding.EncodeToString([]byte("short"))), 0600))
+	assert.NotNil(t, NewFileMasterKeyCacheKeyProvider(keyFile.Name()).Init())
+	assert.NotNil(t, (&MasterKeyCacheKeyProvider{}).Init())
+}
+
+func TestMasterKeyCacheKeyProvider_WrapKey(t *testing.T) {
+	os.Setenv(testMasterKeyEnv, newMasterKey(t))
+	defer os.Unsetenv(testMasterKeyEnv)
+	keyProvider := NewEnvMasterKeyCacheKeyProvider(testMasterKeyEnv)
+	assert.Nil(t, keyProvider.Init())
+
+	key := []byte("0123456789abcdef0123456789abcdef")
+	wrappedKey, err := keyProvider.WrapKey(key)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(wrappedKey), string(key))
+	unwrappedKey, err := keyProvider.UnwrapKey(wrappedKey)
+	assert.Nil(t, err)
+	assert.Equal(t, key, unwrappedKey)
+
+	// 其他主密钥无法解包
+	os.Setenv(testMasterKeyEnv, newMasterKey(t))
+	otherKeyProvider := NewEnvMasterKeyCacheKeyProvider(testMasterKeyEnv)
+	assert.Nil(t, otherKeyProvider.Init())
+	_, err = otherKeyProvider.UnwrapKey(wrappedKey)
+	assert.NotNil(t, err)
+	_, err = keyProvider.UnwrapKey(wrappedKey[:4])
+	assert.NotNil(t, err)
+}
+
+func TestMasterKeyCacheKeyProvider_CloseConcurrent(t *testing.T) {
+	os.Setenv(testMasterKeyEnv, newMasterKey(t))
+	defer os.Unsetenv(testMasterKeyEnv)
+	keyProvider := NewEnvMasterKeyCacheKeyProvider(testMasterKeyEnv)
+	assert.Nil(t, keyProvider.Init())
+
+	// 关闭时可能仍有刷新在包装或解包数据密钥
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				wrappedKey, err := keyProvider.WrapKey([]byte("0123456789abcdef0123456789abcdef"))
+				if err == nil {
+					keyProvider.UnwrapKey(wrappedKey)
+				}
+			}
+		}()
+	}
+	assert.Nil(t, keyProvider.Close())
+	wg.Wait()
+	_, err := keyProvider.WrapKey([]byte("0123456789abcdef0123456789abcdef"))
+	assert.NotNil(t, err)
+}
+
+func TestFileCacheSecretStoreStrategy_KmsKeyProvider(t *testing.T) {
+	cacheSecretPath := newTempCachePath(t)
+	defer os.RemoveAll(cacheSecretPath)
+	cryptoClient := &fakeKmsCryptoClient{}
+	store := NewFileCacheSecretStoreStrategy(cacheSecretPath, true, "salt").
+		WithKeyProvider(NewKmsCacheKeyProvider(cryptoClient, "alias/cache"))
+	assert.Nil(t, store.Init())
+	assert.Nil(t, store.StoreSecret(newCacheSecretInfo("secret", "v1", "value1", utils.StageAcsCurrent)))
+	// 包装数据密钥及首次写入时生成的完整性校验密钥
+	assert.Equal(t, 2, cryptoClient.encryptCount)
+	assert.Nil(t, store.StoreSecret(newCacheSecretInfo("secret", "v2", "value2", utils.StageAcsCurrent)))
+	assert.Equal(t, 3, cryptoClient.encryptCount)
+
+	_, fileCacheSecretInfo := readCacheSecretEntry(t, cacheSecretPath, "secret")
+	decodeBytes, err := base64.StdEncoding.DecodeString(fileCacheSecretInfo.SecretInfo.SecretValue)
+	assert.Nil(t, err)
+	assert.Equal(t, utils.Aes256GcmEnvelopeModeKey, string(decodeBytes[:3]))
+
+	reloadStore := NewFileCacheSecretStoreStrategy(cacheSecretPath, true, "salt").
+		WithKeyProvider(NewKmsCacheKeyProvider(cryptoClient, "alias/cache"))
+	assert.Nil(t, reloadStore.Init())
+	cacheSecretInfo, err := reloadStore.GetCacheSecretInfoByStage("secret", utils.StageAcsCurrent)
+	assert.Nil(t, err)
+	assert.Equal(t, "value2", cacheSecretInfo.SecretInfo.SecretValue)
+	assert.Equal(t, 2, cryptoClient.decryptCount)
+	assert.Equal(t, []string{"https", "https", "https", "https", "https"}, cryptoClient.schemes)
+
+	// 使用其他KeyProvider时无法读取
+	plainStore := NewFileCacheSecretStoreStrategy(cacheSecretPath, true, "salt")
+	assert.Nil(t, plainStore.Init())
+	_, err = plainStore.GetCacheSecretInfoByStage("secret", utils.StageAcsCurrent)
+	assert.NotNil(t, err)
+}
+
+func TestFileCacheSecretStoreStrategy_MasterKeyProvider(t *testing.T) {
+	cacheSecretPath := newTempCachePath(t)
+	defer os.RemoveAll(cacheSecretPath)
+	os.Setenv(testMasterKeyEnv, newMasterKey(t))
+	defer os.Unsetenv(testMasterKeyEnv)
+	store := NewFileCacheSecretStoreStrategy(cacheSecretPath, true, "salt").
+		WithKeyProvider(NewEnvMasterKeyCacheKeyProvider(testMasterKeyEnv))
+	assert.Nil(t, store.Init())
+	assert.Nil(t, store.StoreSecret(newCacheSecretInfo("secret", "v1", "value1", utils.StageAcsCurrent)))
+
+	// 主密钥变更后无法解密缓存文件
+	os.Setenv(testMasterKeyEnv, newMasterKey(t))
+	reloadStore := NewFileCacheSecretStoreStrategy(cacheSecretPath, true, "salt").
+		WithKeyProvider(NewEnvMasterKeyCacheKeyProvider(testMasterKeyEnv))
+	assert.Nil(t, reloadStore.Init())
+	_, err := reloadStore.GetCacheSecretInfoByStage("secret", utils.StageAcsCurrent)
+	assert.NotNil(t, err)
+	assert.Nil(t, reloadStore.Close())
+}
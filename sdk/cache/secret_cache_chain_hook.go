@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"errors"
+
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/logger"
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/models"
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/utils"
+)
+
+// ChainSecretCacheHook 组合多个hook，Put按顺序执行，Get按逆序执行，
+// RecoveryGetSecret依次尝试各hook直到恢复成功
+type ChainSecretCacheHook struct {
+	hooks []SecretCacheHook
+}
+
+func NewChainSecretCacheHook(hooks ...SecretCacheHook) *ChainSecretCacheHook {
+	return &ChainSecretCacheHook{
+		hooks: hooks,
+	}
+}
+
+// 初始化所有hook，返回所有初始化失败的错误
+func (ch *ChainSecretCacheHook) Init() error {
+	if len(ch.hooks) == 0 {
+		return errors.New("the argument hooks must not be empty")
+	}
+	var errs []error
+	for _, hook := range ch.hooks {
+		errs = append(errs, hook.Init())
+	}
+	return utils.NewMultiError(errs...)
+}
+
+// 上一个hook输出的凭据作为下一个hook的输入，stage取最后一个非空值，
+// 刷新时间取各hook中最早的，避免恢复凭据的存在时间被后续hook重置
+func (ch *ChainSecretCacheHook) Put(o *models.SecretInfo) (*models.CacheSecretInfo, error) {
+	var result *models.CacheSecretInfo
+	secretInfo := o
+	for _, hook := range ch.hooks {
+		cacheSecretInfo, err := hook.Put(secretInfo)
+		if err != nil {
+			return nil, err
+		}
+		if cacheSecretInfo == nil {
+			return nil, nil
+		}
+		if result != nil {
+			if cacheSecretInfo.Stage == "" {
+				cacheSecretInfo.Stage = result.Stage
+			}
+			if result.RefreshTimestamp < cacheSecretInfo.RefreshTimestamp {
+				cacheSecretInfo.RefreshTimestamp = result.RefreshTimestamp
+			}
+		}
+		result = cacheSecretInfo
+		secretInfo = cacheSecretInfo.SecretInfo
+	}
+	return result, nil
+}
+
+func (ch *ChainSecretCacheHook) Get(cachedObject *models.CacheSecretInfo) (*models.SecretInfo, error) {
+	var secretInfo *models.SecretInfo
+	cacheSecretInfo := cachedObject
+	for i := len(ch.hooks) - 1; i >= 0; i-- {
+		var err error
+		secretInfo, err = ch.hooks[i].Get(cacheSecretInfo)
+		if err != nil {
+			return nil, err
+		}
+		cacheSecretInfo = &models.CacheSecretInfo{
+			SecretInfo:       secretInfo,
+			Stage:            cachedObject.Stage,
+			RefreshTimestamp: cachedObject.RefreshTimestamp,
+		}
+	}
+	return secretInfo, nil
+}
+
+// 返回第一个恢复成功的凭据，均未恢复时返回各hook的错误
+func (ch *ChainSecretCacheHook) RecoveryGetSecret(secretName string) (*models.SecretInfo, error) {
+	var errs []error
+	for _, hook := range ch.hooks {
+		secretInfo, err := hook.RecoveryGetSecret(secretName)
+		if err != nil {
+			logger.GetCommonLogger(utils.ModeName).Errorf("action:chainRecoveryGetSecret, secretName:%s, %+v", secretName, err)
+			errs = append(errs, err)
+			continue
+		}
+		if secretInfo != nil {
+			return secretInfo, nil
+		}
+	}
+	return nil, utils.NewMultiError(errs...)
+}
+
+// 按初始化的逆序关闭所有hook，返回所有关闭失败的错误
+func (ch *ChainSecretCacheHook) Close() error {
+	var errs []error
+	for i := len(ch.hooks) - 1; i >= 0; i-- {
+		errs = append(errs, ch.hooks[i].Close())
+	}
+	return utils.NewMultiError(errs...)
+}
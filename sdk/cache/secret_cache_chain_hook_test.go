@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/models"
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 记录调用顺序，Put时在凭据值后追加name，Get时去除
+type recordSecretCacheHook struct {
+	name     string
+	calls    *[]string
+	recovery *models.SecretInfo
+	err      error
+}
+
+func (rh *recordSecretCacheHook) Init() error {
+	*rh.calls = append(*rh.calls, "init:"+rh.name)
+	return rh.err
+}
+
+func (rh *recordSecretCacheHook) Put(o *models.SecretInfo) (*models.CacheSecretInfo, error) {
+	*rh.calls = append(*rh.calls, "put:"+rh.name)
+	secretInfo := o.Clone()
+	secretInfo.SecretValue += "|" + rh.name
+	return &models.CacheSecretInfo{SecretInfo: secretInfo, RefreshTimestamp: time.Now().UnixNano() / 1e6}, nil
+}
+
+func (rh *recordSecretCacheHook) Get(cachedObject *models.CacheSecretInfo) (*models.SecretInfo, error) {
+	*rh.calls = append(*rh.calls, "get:"+rh.name)
+	secretInfo := cachedObject.SecretInfo.Clone()
+	secretInfo.SecretValue = secretInfo.SecretValue[:len(secretInfo.SecretValue)-len(rh.name)-1]
+	return secretInfo, nil
+}
+
+func (rh *recordSecretCacheHook) RecoveryGetSecret(secretName string) (*models.SecretInfo, error) {
+	*rh.calls = append(*rh.calls, "recovery:"+rh.name)
+	return rh.recovery, rh.err
+}
+
+func (rh *recordSecretCacheHook) Close() error {
+	*rh.calls = append(*rh.calls, "close:"+rh.name)
+	return rh.err
+}
+
+func TestChainSecretCacheHook(t *testing.T) {
+	var calls []string
+	chain := NewChainSecretCacheHook(
+		NewDefaultSecretCacheHook(utils.StageAcsCurrent),
+		&recordSecretCacheHook{name: "a", calls: &calls},
+		&recordSecretCacheHook{name: "b", calls: &calls},
+	)
+	assert.Nil(t, chain.Init())
+
+	cacheSecretInfo, err := chain.Put(&models.SecretInfo{SecretName: "secret", SecretValue: "value"})
+	assert.Nil(t, err)
+	assert.Equal(t, "value|a|b", cacheSecretInfo.SecretInfo.SecretValue)
+	assert.Equal(t, utils.StageAcsCurrent, cacheSecretInfo.Stage)
+	secretInfo, err := chain.Get(cacheSecretInfo)
+	assert.Nil(t, err)
+	assert.Equal(t, "value", secretInfo.SecretValue)
+
+	secretInfo, err = chain.RecoveryGetSecret("secret")
+	assert.Nil(t, err)
+	assert.Nil(t, secretInfo)
+	assert.Nil(t, chain.Close())
+	assert.Equal(t, []string{"init:a", "init:b", "put:a", "put:b", "get:b", "get:a", "recovery:a", "recovery:b", "close:b", "close:a"}, calls)
+}
+
+func TestChainSecretCacheHook_Recovery(t *testing.T) {
+	cacheSecretPath := newTempCachePath(t)
+	defer os.RemoveAll(cacheSecretPath)
+	store := NewFileCacheSecretStoreStrategy(cacheSecretPath, true, "salt")
+	assert.Nil(t, store.Init())
+	refreshTimestamp := time.Now().Add(-time.Second).UnixNano() / 1e6
+	cacheSecretInfo := newCacheSecretInfo("secret", "v1", "value1", utils.StageAcsCurrent)
+	cacheSecretInfo.RefreshTimestamp = refreshTimestamp
+	assert.Nil(t, store.StoreSecret(cacheSecretInfo))
+
+	var calls []string
+	recoveryErr := errors.New("recovery failed")
+	chain := NewChainSecretCacheHook(
+		&recordSecretCacheHook{name: "a", calls: &calls, err: recoveryErr},
+		NewFileRecoverySecretCacheHook(utils.StageAcsCurrent, store, 0),
+		&recordSecretCacheHook{name: "b", calls: &calls},
+	)
+	secretInfo, err := chain.RecoveryGetSecret("secret")
+	assert.Nil(t, err)
+	assert.True(t, secretInfo.Recovered)
+	assert.Equal(t, []string{"recovery:a"}, calls)
+
+	// 恢复凭据的刷新时间不被后续hook重置
+	recovered, err := chain.Put(secretInfo)
+	assert.Nil(t, err)
+	assert.Equal(t, refreshTimestamp, recovered.RefreshTimestamp)
+	assert.Equal(t, utils.StageAcsCurrent, recovered.Stage)
+
+	// 所有hook均未恢复时返回聚合的错误
+	_, err = NewChainSecretCacheHook(&recordSecretCacheHook{name: "c", calls: &calls, err: recoveryErr}).RecoveryGetSecret("secret")
+	var multiErr *utils.MultiError
+	assert.True(t, errors.As(err, &multiErr))
+	assert.True(t, errors.Is(err, recoveryErr))
+}
+
+func TestChainSecretCacheHook_InitClose(t *testing.T) {
+	var calls []string
+	initErr := errors.New("init failed")
+	chain := NewChainSecretCacheHook(
+		&recordSecretCacheHook{name: "a", calls: &calls, err: initErr},
+		&recordSecretCacheHook{name: "b", calls: &calls},
+	)
+	err := chain.Init()
+	assert.True(t, errors.Is(err, initErr))
+	err = chain.Close()
+	assert.True(t, errors.Is(err, initErr))
+	assert.Equal(t, []string{"init:a", "init:b", "close:b", "close:a"}, calls)
+	assert.NotNil(t, NewChainSecretCacheHook().Init())
+}
@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/logger"
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/models"
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/utils"
+)
+
+// NewFileRecoverySecretCacheHook KMS不可用时从文件缓存读取最近一次成功获取的凭据，
+// store需与WithCacheSecretStrategy使用同一个FileCacheSecretStoreStrategy，reloadOnStart为true时重启后仍可恢复,
+// maxAge为允许恢复的凭据最大存在时间，单位ms，小于等于0时不限制
+func NewFileRecoverySecretCacheHook(stage string, store *FileCacheSecretStoreStrategy, maxAge int64) SecretCacheHook {
+	return &fileRecoverySecretCacheHook{
+		stage:  stage,
+		store:  store,
+		maxAge: maxAge,
+	}
+}
+
+// 从文件缓存恢复凭据的hook，恢复的凭据Recovered为true
+type fileRecoverySecretCacheHook struct {
+	// 缓存的凭据Version Stage
+	stage  string
+	store  *FileCacheSecretStoreStrategy
+	maxAge int64
+	// 恢复的凭据对应的原始刷新时间，key由凭据名称及stage组成
+	recoveredTimestamps sync.Map
+}
+
+func (frh *fileRecoverySecretCacheHook) Init() error {
+	if frh.store == nil {
+		return errors.New("the argument store must not be nil")
+	}
+	return nil
+}
+
+// 恢复的凭据使用原始刷新时间缓存，保证凭据存在时间按首次获取时计算
+func (frh *fileRecoverySecretCacheHook) Put(o *models.SecretInfo) (*models.CacheSecretInfo, error) {
+	refreshTimestamp := time.Now().UnixNano() / 1e6
+	if o.Recovered {
+		if timestamp, ok := frh.recoveredTimestamps.Load(getCacheKey(o.SecretName, frh.stage)); ok {
+			refreshTimestamp = timestamp.(int64)
+		}
+	} else {
+		frh.recoveredTimestamps.Delete(getCacheKey(o.SecretName, frh.stage))
+	}
+	return &models.CacheSecretInfo{
+		SecretInfo:       o,
+		Stage:            frh.stage,
+		RefreshTimestamp: refreshTimestamp,
+	}, nil
+}
+
+func (frh *fileRecoverySecretCacheHook) Get(cachedObject *models.CacheSecretInfo) (*models.SecretInfo, error) {
+	return cachedObject.SecretInfo, nil
+}
+
+// 无可用缓存或缓存超过最大存在时间时返回nil，由调用方返回原始错误
+func (frh *fileRecoverySecretCacheHook) RecoveryGetSecret(secretName string) (*models.SecretInfo, error) {
+	cacheSecretInfo, err := frh.store.GetCacheSecretInfoByStage(secretName, frh.stage)
+	if err != nil {
+		logger.GetCommonLogger(utils.ModeName).Errorf("action:recoveryGetSecret, secretName:%s, %+v", secretName, err)
+		return nil, nil
+	}
+	age := time.Now().UnixNano()/1e6 - cacheSecretInfo.RefreshTimestamp
+	if frh.maxAge > 0 && age > frh.maxAge {
+		logger.GetCommonLogger(utils.ModeName).Warnf("action:recoveryGetSecret, secretName:%s, cache age %dms exceeds max age %dms", secretName, age, frh.maxAge)
+		return nil, nil
+	}
+	frh.recoveredTimestamps.Store(getCacheKey(secretName, frh.stage), cacheSecretInfo.RefreshTimestamp)
+	secretInfo := cacheSecretInfo.SecretInfo.Clone()
+	secretInfo.Recovered = true
+	return secretInfo, nil
+}
+
+func (frh *fileRecoverySecretCacheHook) Close() error {
+	return nil
+}
@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileRecoverySecretCacheHook(t *testing.T) {
+	cacheSecretPath := newTempCachePath(t)
+	defer os.RemoveAll(cacheSecretPath)
+	store := NewFileCacheSecretStoreStrategy(cacheSecretPath, true, "salt")
+	assert.Nil(t, store.Init())
+	hook := NewFileRecoverySecretCacheHook(utils.StageAcsCurrent, store, 60*1000)
+	assert.Nil(t, hook.Init())
+
+	secretInfo, err := hook.RecoveryGetSecret("secret")
+	assert.Nil(t, err)
+	assert.Nil(t, secretInfo)
+
+	refreshTimestamp := time.Now().Add(-time.Second).UnixNano() / 1e6
+	cacheSecretInfo := newCacheSecretInfo("secret", "v1", "value1", utils.StageAcsCurrent)
+	cacheSecretInfo.RefreshTimestamp = refreshTimestamp
+	assert.Nil(t, store.StoreSecret(cacheSecretInfo))
+	secretInfo, err = hook.RecoveryGetSecret("secret")
+	assert.Nil(t, err)
+	assert.True(t, secretInfo.Recovered)
+	assert.Equal(t, "value1", secretInfo.SecretValue)
+	cached, err := store.GetCacheSecretInfoByStage("secret", utils.StageAcsCurrent)
+	assert.Nil(t, err)
+	assert.False(t, cached.SecretInfo.Recovered)
+
+	// 恢复的凭据使用原始刷新时间缓存
+	recovered, err := hook.Put(secretInfo)
+	assert.Nil(t, err)
+	assert.Equal(t, refreshTimestamp, recovered.RefreshTimestamp)
+	put, err := hook.Put(cached.SecretInfo)
+	assert.Nil(t, err)
+	assert.True(t, put.RefreshTimestamp > refreshTimestamp)
+	assert.Nil(t, hook.Close())
+}
+
+func TestFileRecoverySecretCacheHook_Stages(t *testing.T) {
+	cacheSecretPath := newTempCachePath(t)
+	defer os.RemoveAll(cacheSecretPath)
+	store := NewFileCacheSecretStoreStrategy(cacheSecretPath, true, "salt")
+	assert.Nil(t, store.Init())
+	currentTimestamp := time.Now().Add(-time.Second).UnixNano() / 1e6
+	previousTimestamp := time.Now().Add(-2*time.Second).UnixNano() / 1e6
+	current := newCacheSecretInfo("secret", "v2", "value2", utils.StageAcsCurrent)
+	current.RefreshTimestamp = currentTimestamp
+	previous := newCacheSecretInfo("secret", "v1", "value1", stageAcsPrevious)
+	previous.RefreshTimestamp = previousTimestamp
+	assert.Nil(t, store.StoreSecret(current))
+	assert.Nil(t, store.StoreSecret(previous))
+
+	hook := NewFileRecoverySecretCacheHook(utils.StageAcsCurrent, store, 0).(*fileRecoverySecretCacheHook)
+	_, err := hook.RecoveryGetSecret("secret")
+	assert.Nil(t, err)
+	// 恢复的原始刷新时间按凭据名称及stage记录
+	timestamp, ok := hook.recoveredTimestamps.Load(getCacheKey("secret", utils.StageAcsCurrent))
+	assert.True(t, ok)
+	assert.Equal(t, currentTimestamp, timestamp)
+	_, ok = hook.recoveredTimestamps.Load("secret")
+	assert.False(t, ok)
+
+	previousHook := NewFileRecoverySecretCacheHook(stageAcsPrevious, store, 0)
+	secretInfo, err := previousHook.RecoveryGetSecret("secret")
+	assert.Nil(t, err)
+	assert.Equal(t, "value1", secretInfo.SecretValue)
+	recovered, err := previousHook.Put(secretInfo)
+	assert.Nil(t, err)
+	assert.Equal(t, previousTimestamp, recovered.RefreshTimestamp)
+}
+
+func TestFileRecoverySecretCacheHook_MaxAge(t *testing.T) {
+	cacheSecretPath := newTempCachePath(t)
+	defer os.RemoveAll(cacheSecretPath)
+	store := NewFileCacheSecretStoreStrategy(cacheSecretPath, true, "salt")
+	assert.Nil(t, store.Init())
+	cacheSecretInfo := newCacheSecretInfo("secret", "v1", "value1", utils.StageAcsCurrent)
+	cacheSecretInfo.RefreshTimestamp = time.Now().Add(-time.Minute).UnixNano() / 1e6
+	assert.Nil(t, store.StoreSecret(cacheSecretInfo))
+
+	hook := NewFileRecoverySecretCacheHook(utils.StageAcsCurrent, store, 1000)
+	secretInfo, err := hook.RecoveryGetSecret("secret")
+	assert.Nil(t, err)
+	assert.Nil(t, secretInfo)
+	// 不限制最大存在时间
+	secretInfo, err = NewFileRecoverySecretCacheHook(utils.StageAcsCurrent, store, 0).RecoveryGetSecret("secret")
+	assert.Nil(t, err)
+	assert.Equal(t, "value1", secretInfo.SecretValue)
+
+	assert.NotNil(t, NewFileRecoverySecretCacheHook(utils.StageAcsCurrent, nil, 0).Init())
+}
@@ -1,13 +1,22 @@
 package cache
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/logger"
 	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/models"
 	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/utils"
 	mapset "github.com/deckarep/golang-set"
@@ -17,6 +26,18 @@ import (
 const (
 	JsonFileNamePrefix = "stage_"
 	JsonFileNameSuffix = ".json"
+
+	// 内存缓存key中凭据名称与stage的分隔符
+	cacheKeySeparator = "\x00"
+
+	// 包装密钥长度字段字节数
+	wrappedKeyLengthSize = 2
+
+	// 完整性校验密钥长度
+	macKeyLength = 32
+
+	// 校验失败的缓存文件重命名后缀
+	quarantineFileSuffix = ".quarantine."
 )
 
 // SecretCacheStoreStrategy 缓存secret策略
@@ -34,15 +55,49 @@ type SecretCacheStoreStrategy interface {
 	Close() error
 }
 
+// StageAwareSecretCacheStoreStrategy 可按stage获取缓存的策略，未实现时按凭据名称获取
+type StageAwareSecretCacheStoreStrategy interface {
+	SecretCacheStoreStrategy
+
+	// 获取指定stage的secret缓存信息
+	GetCacheSecretInfoByStage(secretName, stage string) (*models.CacheSecretInfo, error)
+}
+
+// RemovableSecretCacheStoreStrategy 可移除缓存的策略，未实现时以已过期的缓存覆盖
+type RemovableSecretCacheStoreStrategy interface {
+	SecretCacheStoreStrategy
+
+	// 移除secret所有stage的缓存信息
+	RemoveSecret(secretName string) error
+}
+
 type FileCacheSecretStoreStrategy struct {
 	// 缓存凭据文件路径
 	CacheSecretPath string
 	// 首次启动时候是否允许从文件进行加载，true为允许
 	ReloadOnStart bool
 	//加解密过程中使用的salt
-	Salt               string
-	ReloadedSet        mapset.Set
-	CacheSecretInfoMap cmap.ConcurrentMap
+	Salt string
+	// 数据密钥包装方式，为空时使用环境变量cache_client_master_key中的主密钥，环境变量未设置时使用由salt派生的密钥
+	KeyProvider CacheKeyProvider
+	// 是否禁止加载旧版本写入的不含完整性校验值的aes256-cbc缓存文件，默认加载并视为已过期，
+	// 使用包装后的数据密钥重新加密并附加完整性校验值写入
+	DisableLegacyMigration bool
+	ReloadedSet            mapset.Set
+	CacheSecretInfoMap     cmap.ConcurrentMap
+	// 写入缓存文件使用的随机完整性校验密钥及KeyProvider包装后的结果，首次写入时生成
+	macKeyMtx     sync.Mutex
+	macKey        []byte
+	wrappedMacKey string
+	// 已解包的完整性校验密钥，包装后的结果为key
+	unwrappedMacKeys sync.Map
+}
+
+// 缓存文件内容，MacKey为KeyProvider包装后的完整性校验密钥，Mac为凭据名称、stage及CacheSecretInfo序列化结果的hmac-sha256
+type fileCacheSecretEntry struct {
+	CacheSecretInfo json.RawMessage `json:"cacheSecretInfo"`
+	MacKey          string          `json:"macKey,omitempty"`
+	Mac             string          `json:"mac"`
 }
 
 type MemoryCacheSecretStoreStrategy struct {
@@ -59,6 +114,18 @@ func NewFileCacheSecretStoreStrategy(cacheSecretPath string, reloadOnStart bool,
 	}
 }
 
+// 设置数据密钥包装方式，缓存文件中只存储包装后的数据密钥
+func (fs *FileCacheSecretStoreStrategy) WithKeyProvider(keyProvider CacheKeyProvider) *FileCacheSecretStoreStrategy {
+	fs.KeyProvider = keyProvider
+	return fs
+}
+
+// 设置是否迁移旧版本缓存文件，默认迁移，迁移后的缓存视为已过期，将尽快从服务端刷新，并使用包装后的数据密钥重新写入
+func (fs *FileCacheSecretStoreStrategy) WithLegacyMigration(legacyMigration bool) *FileCacheSecretStoreStrategy {
+	fs.DisableLegacyMigration = !legacyMigration
+	return fs
+}
+
 func NewMemoryCacheSecretStoreStrategy() *MemoryCacheSecretStoreStrategy {
 	return &MemoryCacheSecretStoreStrategy{
 		CacheSecretInfoMap: cmap.New(),
@@ -72,7 +139,15 @@ func (fs *FileCacheSecretStoreStrategy) Init() error {
 	if fs.Salt == "" {
 		return errors.New("the argument salt must not be empty")
 	}
-	return nil
+	if fs.KeyProvider == nil {
+		if _, ok := os.LookupEnv(utils.EnvCacheMasterKeyKey); ok {
+			fs.KeyProvider = NewEnvMasterKeyCacheKeyProvider(utils.EnvCacheMasterKeyKey)
+		} else {
+			logger.GetCommonLogger(utils.ModeName).Warnf("action:initFileCache, env [%s] not found and no key provider set, the data keys of the file cache are wrapped with a key derived from the salt, set env [%s] or call WithKeyProvider to protect them", utils.EnvCacheMasterKeyKey, utils.EnvCacheMasterKeyKey)
+			fs.KeyProvider = newSaltCacheKeyProvider(fs.Salt)
+		}
+	}
+	return fs.KeyProvider.Init()
 }
 
 func (fs *FileCacheSecretStoreStrategy) StoreSecret(cacheSecretInfo *models.CacheSecretInfo) error {
@@ -80,69 +155,135 @@ func (fs *FileCacheSecretStoreStrategy) StoreSecret(cacheSecretInfo *models.Cach
 	fileCacheSecretInfo := cacheSecretInfo.Clone()
 	secretInfo := fileCacheSecretInfo.SecretInfo
 	secretValue := secretInfo.SecretValue
+	cacheSecretPath, fileName, err := fs.getCacheSecretFile(secretInfo.SecretName, cacheSecretInfo.Stage)
+	if err != nil {
+		return err
+	}
 	key, err := fs.generateRandomKey()
 	if err != nil {
 		return err
 	}
-	encryptedValue, err := fs.encryptSecretValue(secretValue, key)
+	encryptedValue, err := fs.encryptSecretValue(secretValue, key, getAdditionalData(secretInfo.SecretName, cacheSecretInfo.Stage))
 	if err != nil {
 		return err
 	}
 	secretInfo.SecretValue = encryptedValue
-	fileName := strings.ToLower(JsonFileNamePrefix + cacheSecretInfo.Stage + JsonFileNameSuffix)
-	cacheSecretPath := fs.CacheSecretPath + string(os.PathSeparator) + secretInfo.SecretName
-	if utils.FileExists(cacheSecretPath, fileName) {
-		err = utils.FileDelete(cacheSecretPath, fileName)
-		if err != nil {
-			return err
-		}
-	}
-	err = utils.WriteJsonObject(cacheSecretPath, fileName, fileCacheSecretInfo)
+	cacheKey := getCacheKey(secretInfo.SecretName, cacheSecretInfo.Stage)
+	err = fs.writeCacheSecretFile(cacheSecretPath, fileName, cacheKey, fileCacheSecretInfo)
 	if err != nil {
 		return err
 	}
-	fs.CacheSecretInfoMap.Set(secretInfo.SecretName, memoryCacheSecretInfo)
-	fs.ReloadedSet.Add(cacheSecretInfo.SecretInfo.SecretName)
+	fs.CacheSecretInfoMap.Set(cacheKey, memoryCacheSecretInfo)
+	fs.ReloadedSet.Add(cacheKey)
 	return nil
 }
 
+// 获取ACSCurrent的secret缓存信息
 func (fs *FileCacheSecretStoreStrategy) GetCacheSecretInfo(secretName string) (*models.CacheSecretInfo, error) {
-	if !fs.ReloadOnStart && !fs.ReloadedSet.Contains(secretName) {
-		return nil, errors.New(fmt.Sprintf("reloadedSet can't find [%s] key", secretName))
+	return fs.GetCacheSecretInfoByStage(secretName, utils.StageAcsCurrent)
+}
+
+func (fs *FileCacheSecretStoreStrategy) GetCacheSecretInfoByStage(secretName, stage string) (*models.CacheSecretInfo, error) {
+	cacheKey := getCacheKey(secretName, stage)
+	if !fs.ReloadOnStart && !fs.ReloadedSet.Contains(cacheKey) {
+		return nil, errors.New(fmt.Sprintf("reloadedSet can't find [%s] key with stage [%s]", secretName, stage))
 	}
-	if cacheSecretInfoI, ok := fs.CacheSecretInfoMap.Get(secretName); ok {
+	if cacheSecretInfoI, ok := fs.CacheSecretInfoMap.Get(cacheKey); ok {
 		if cacheSecretInfo, okk := cacheSecretInfoI.(*models.CacheSecretInfo); okk {
 			return cacheSecretInfo, nil
 		} else {
 			return nil, errors.New(fmt.Sprintf("CacheSecretInfoMap unknown type, expect: *models.CacheSecretInfo"))
 		}
 	}
-	fileName := strings.ToLower(JsonFileNamePrefix + utils.StageAcsCurrent + JsonFileNameSuffix)
-	cacheSecretPath := fs.CacheSecretPath + string(os.PathSeparator) + secretName
-	var cacheSecretInfo *models.CacheSecretInfo
-	err := utils.ReadJsonObject(cacheSecretPath, fileName, &cacheSecretInfo)
+	cacheSecretPath, fileName, err := fs.getCacheSecretFile(secretName, stage)
+	if err != nil {
+		return nil, err
+	}
+	cacheSecretInfo, legacy, err := fs.readCacheSecretFile(cacheSecretPath, fileName, cacheKey)
 	if err != nil {
 		return nil, err
 	}
 	secretInfo := cacheSecretInfo.SecretInfo
-	secretValue, err := fs.decryptSecretValue(secretInfo.SecretValue)
+	secretValue, err := fs.decryptSecretValue(secretInfo.SecretValue, getAdditionalData(secretName, stage), legacy)
 	if err != nil {
+		if errors.Is(err, utils.ErrCacheIntegrity) {
+			fs.quarantine(cacheSecretPath, fileName, err)
+		}
 		return nil, err
 	}
 	secretInfo.SecretValue = secretValue
-	fs.CacheSecretInfoMap.Set(secretInfo.SecretName, cacheSecretInfo)
+	if legacy {
+		// 旧版本写入的缓存文件视为已过期，使用包装后的数据密钥重新加密并附加完整性校验值写入
+		cacheSecretInfo.RefreshTimestamp = 0
+		if err := fs.upgradeCacheSecretFile(cacheSecretPath, fileName, cacheKey, cacheSecretInfo); err != nil {
+			logger.GetCommonLogger(utils.ModeName).Warnf("action:upgradeLegacyCacheFile, secretName:%s, %+v", secretName, err)
+		} else {
+			logger.GetCommonLogger(utils.ModeName).Infof("action:upgradeLegacyCacheFile, secretName:%s migrated", secretName)
+		}
+	}
+	fs.CacheSecretInfoMap.Set(cacheKey, cacheSecretInfo)
 	return cacheSecretInfo, nil
 }
 
-func (fs *FileCacheSecretStoreStrategy) encryptSecretValue(secretValue string, key []byte) (string, error) {
-	iv := make([]byte, utils.IvLength)
-	_, err := rand.Read(iv)
+// 重新加密迁移的缓存并写入缓存文件
+func (fs *FileCacheSecretStoreStrategy) upgradeCacheSecretFile(cacheSecretPath, fileName, cacheKey string, cacheSecretInfo *models.CacheSecretInfo) error {
+	fileCacheSecretInfo := cacheSecretInfo.Clone()
+	key, err := fs.generateRandomKey()
+	if err != nil {
+		return err
+	}
+	encryptedValue, err := fs.encryptSecretValue(fileCacheSecretInfo.SecretInfo.SecretValue, key, []byte(cacheKey))
+	if err != nil {
+		return err
+	}
+	fileCacheSecretInfo.SecretInfo.SecretValue = encryptedValue
+	return fs.writeCacheSecretFile(cacheSecretPath, fileName, cacheKey, fileCacheSecretInfo)
+}
+
+func (fs *FileCacheSecretStoreStrategy) RemoveSecret(secretName string) error {
+	for _, cacheKey := range getSecretCacheKeys(fs.CacheSecretInfoMap, secretName) {
+		fs.CacheSecretInfoMap.Remove(cacheKey)
+	}
+	for _, cacheKey := range fs.ReloadedSet.ToSlice() {
+		if isSecretCacheKey(cacheKey.(string), secretName) {
+			fs.ReloadedSet.Remove(cacheKey)
+		}
+	}
+	if err := utils.ValidateRelativePath(secretName); err != nil {
+		return err
+	}
+	cacheSecretPath := filepath.Join(fs.CacheSecretPath, secretName)
+	fileNames, err := filepath.Glob(filepath.Join(cacheSecretPath, JsonFileNamePrefix+"*"+JsonFileNameSuffix))
+	if err != nil {
+		return err
+	}
+	for _, fileName := range fileNames {
+		if err = os.Remove(fileName); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// 使用aes256-gcm加密，凭据名称及stage作为附加认证数据，数据密钥由KeyProvider包装，
+// 格式为:版本号|包装密钥长度|包装密钥|随机数|密文
+func (fs *FileCacheSecretStoreStrategy) encryptSecretValue(secretValue string, key, additionalData []byte) (string, error) {
+	nonce := make([]byte, utils.GcmNonceLength)
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+	wrappedKey, err := fs.KeyProvider.WrapKey(key)
 	if err != nil {
 		return "", err
 	}
-	encrypted := []byte(utils.Aes256CbcModeKey)
-	encrypted = append(append(encrypted, key...), iv...)
-	cipherData, err := utils.EncryptAes256Cbc([]byte(secretValue), key, iv, []byte(fs.Salt))
+	if len(wrappedKey) > math.MaxUint16 {
+		return "", errors.New(fmt.Sprintf("invalid wrapped key length:%d", len(wrappedKey)))
+	}
+	encrypted := []byte(utils.Aes256GcmEnvelopeModeKey)
+	encrypted = append(encrypted, byte(len(wrappedKey)>>8), byte(len(wrappedKey)))
+	encrypted = append(append(encrypted, wrappedKey...), nonce...)
+	cipherData, err := utils.EncryptAes256Gcm([]byte(secretValue), key, nonce, []byte(fs.Salt), additionalData)
 	if err != nil {
 		return "", err
 	}
@@ -150,15 +291,193 @@ func (fs *FileCacheSecretStoreStrategy) encryptSecretValue(secretValue string, k
 	return base64.StdEncoding.EncodeToString(encrypted), nil
 }
 
-func (fs *FileCacheSecretStoreStrategy) decryptSecretValue(secretValue string) (string, error) {
+// 根据版本号解密，旧版本写入的缓存文件只能为aes256-cbc格式，其他缓存文件只能为数据密钥由KeyProvider包装的aes256-gcm格式
+func (fs *FileCacheSecretStoreStrategy) decryptSecretValue(secretValue string, additionalData []byte, legacy bool) (string, error) {
 	decodeBytes, err := base64.StdEncoding.DecodeString(secretValue)
 	if err != nil {
 		return "", err
 	}
-	key := decodeBytes[len(utils.Aes256CbcModeKey) : len(utils.Aes256CbcModeKey)+utils.RandomKeyLength]
-	iv := decodeBytes[len(utils.Aes256CbcModeKey)+utils.RandomKeyLength : len(utils.Aes256CbcModeKey)+utils.RandomKeyLength+utils.IvLength]
-	cipherData := decodeBytes[len(utils.Aes256CbcModeKey)+utils.RandomKeyLength+utils.IvLength:]
-	return utils.DecryptAes256Cbc(cipherData, key, iv, []byte(fs.Salt))
+	if len(decodeBytes) < len(utils.Aes256CbcModeKey) {
+		return "", errors.New("invalid encrypted secret value")
+	}
+	mode := string(decodeBytes[:len(utils.Aes256CbcModeKey)])
+	decodeBytes = decodeBytes[len(utils.Aes256CbcModeKey):]
+	if legacy != (mode == utils.Aes256CbcModeKey) {
+		return "", fmt.Errorf("unexpected encryption mode [%s]: %w", mode, utils.ErrCacheIntegrity)
+	}
+	switch mode {
+	case utils.Aes256GcmEnvelopeModeKey:
+		if len(decodeBytes) < wrappedKeyLengthSize {
+			return "", errors.New("invalid encrypted secret value")
+		}
+		wrappedKeyLength := int(decodeBytes[0])<<8 | int(decodeBytes[1])
+		decodeBytes = decodeBytes[wrappedKeyLengthSize:]
+		if len(decodeBytes) < wrappedKeyLength+utils.GcmNonceLength {
+			return "", errors.New("invalid encrypted secret value")
+		}
+		key, err := fs.KeyProvider.UnwrapKey(decodeBytes[:wrappedKeyLength])
+		if err != nil {
+			return "", err
+		}
+		nonce := decodeBytes[wrappedKeyLength : wrappedKeyLength+utils.GcmNonceLength]
+		cipherData := decodeBytes[wrappedKeyLength+utils.GcmNonceLength:]
+		return utils.DecryptAes256Gcm(cipherData, key, nonce, []byte(fs.Salt), additionalData)
+	case utils.Aes256CbcModeKey:
+		if len(decodeBytes) < utils.RandomKeyLength+utils.IvLength {
+			return "", errors.New("invalid encrypted secret value")
+		}
+		key := decodeBytes[:utils.RandomKeyLength]
+		iv := decodeBytes[utils.RandomKeyLength : utils.RandomKeyLength+utils.IvLength]
+		cipherData := decodeBytes[utils.RandomKeyLength+utils.IvLength:]
+		return utils.DecryptAes256Cbc(cipherData, key, iv, []byte(fs.Salt))
+	}
+	return "", errors.New(fmt.Sprintf("unsupported encryption mode [%s]", mode))
+}
+
+// 写入缓存文件并附加完整性校验值
+func (fs *FileCacheSecretStoreStrategy) writeCacheSecretFile(cacheSecretPath, fileName, cacheKey string, cacheSecretInfo *models.CacheSecretInfo) error {
+	data, err := json.Marshal(cacheSecretInfo)
+	if err != nil {
+		return err
+	}
+	macKey, wrappedMacKey, err := fs.getMacKey()
+	if err != nil {
+		return err
+	}
+	entry := &fileCacheSecretEntry{
+		CacheSecretInfo: data,
+		MacKey:          wrappedMacKey,
+		Mac:             base64.StdEncoding.EncodeToString(computeMac(macKey, cacheKey, data)),
+	}
+	return utils.WriteJsonObject(cacheSecretPath, fileName, entry)
+}
+
+// 获取写入使用的完整性校验密钥，首次调用时生成随机密钥并由KeyProvider包装
+func (fs *FileCacheSecretStoreStrategy) getMacKey() ([]byte, string, error) {
+	fs.macKeyMtx.Lock()
+	defer fs.macKeyMtx.Unlock()
+	if fs.macKey != nil {
+		return fs.macKey, fs.wrappedMacKey, nil
+	}
+	macKey := make([]byte, macKeyLength)
+	if _, err := rand.Read(macKey); err != nil {
+		return nil, "", err
+	}
+	wrappedMacKey, err := fs.KeyProvider.WrapKey(macKey)
+	if err != nil {
+		return nil, "", err
+	}
+	fs.macKey = macKey
+	fs.wrappedMacKey = base64.StdEncoding.EncodeToString(wrappedMacKey)
+	fs.unwrappedMacKeys.Store(fs.wrappedMacKey, macKey)
+	return fs.macKey, fs.wrappedMacKey, nil
+}
+
+// 解包缓存文件中的完整性校验密钥，KeyProvider不同或包装结果被篡改时无法解包
+func (fs *FileCacheSecretStoreStrategy) unwrapMacKey(wrappedMacKey string) ([]byte, error) {
+	if macKey, ok := fs.unwrappedMacKeys.Load(wrappedMacKey); ok {
+		return macKey.([]byte), nil
+	}
+	decodeBytes, err := base64.StdEncoding.DecodeString(wrappedMacKey)
+	if err != nil {
+		return nil, fmt.Errorf("malformed mac key: %w", utils.ErrCacheIntegrity)
+	}
+	macKey, err := fs.KeyProvider.UnwrapKey(decodeBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap mac key: %w", err)
+	}
+	if len(macKey) != macKeyLength {
+		return nil, fmt.Errorf("invalid mac key length:%d: %w", len(macKey), utils.ErrCacheIntegrity)
+	}
+	fs.unwrappedMacKeys.Store(wrappedMacKey, macKey)
+	return macKey, nil
+}
+
+// 读取并校验缓存文件，legacy为true表示旧版本写入的不含完整性校验值的缓存文件，
+// 完整性校验密钥无法解包时返回错误但不隔离，避免KeyProvider暂不可用时丢弃缓存
+func (fs *FileCacheSecretStoreStrategy) readCacheSecretFile(cacheSecretPath, fileName, cacheKey string) (*models.CacheSecretInfo, bool, error) {
+	var data json.RawMessage
+	err := utils.ReadJsonObject(cacheSecretPath, fileName, &data)
+	var cacheSecretInfo *models.CacheSecretInfo
+	legacy := false
+	if err == nil {
+		var entry fileCacheSecretEntry
+		err = json.Unmarshal(data, &entry)
+		if err == nil && entry.Mac == "" && len(entry.CacheSecretInfo) == 0 {
+			// 旧版本的缓存文件内容为CacheSecretInfo，禁止迁移时拒绝读取但不隔离
+			if fs.DisableLegacyMigration {
+				err = errors.New("the cache file was written by an earlier version and legacy migration is disabled")
+			} else {
+				err = json.Unmarshal(data, &cacheSecretInfo)
+				legacy = err == nil && cacheSecretInfo != nil && cacheSecretInfo.SecretInfo != nil
+			}
+		} else if err == nil && entry.MacKey == "" {
+			err = fmt.Errorf("missing mac key: %w", utils.ErrCacheIntegrity)
+		} else if err == nil {
+			var macKey []byte
+			macKey, err = fs.unwrapMacKey(entry.MacKey)
+			if err == nil {
+				err = verifyMac(macKey, cacheKey, &entry)
+			}
+		}
+		if err == nil && len(entry.CacheSecretInfo) > 0 {
+			err = json.Unmarshal(entry.CacheSecretInfo, &cacheSecretInfo)
+		}
+		if err == nil && (cacheSecretInfo == nil || cacheSecretInfo.SecretInfo == nil) {
+			err = fmt.Errorf("empty cacheSecretInfo: %w", utils.ErrCacheIntegrity)
+		}
+	}
+	if err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		if errors.Is(err, utils.ErrCacheIntegrity) || errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+			fs.quarantine(cacheSecretPath, fileName, err)
+		}
+		return nil, false, err
+	}
+	return cacheSecretInfo, legacy, nil
+}
+
+func verifyMac(macKey []byte, cacheKey string, entry *fileCacheSecretEntry) error {
+	mac, err := base64.StdEncoding.DecodeString(entry.Mac)
+	if err != nil || len(mac) == 0 || len(entry.CacheSecretInfo) == 0 {
+		return fmt.Errorf("missing or malformed mac: %w", utils.ErrCacheIntegrity)
+	}
+	if !hmac.Equal(mac, computeMac(macKey, cacheKey, entry.CacheSecretInfo)) {
+		return fmt.Errorf("mac mismatch: %w", utils.ErrCacheIntegrity)
+	}
+	return nil
+}
+
+// 缓存key参与计算，防止缓存文件被替换为其他凭据或stage的文件
+func computeMac(macKey []byte, cacheKey string, data []byte) []byte {
+	h := hmac.New(sha256.New, macKey)
+	h.Write([]byte(cacheKey))
+	h.Write([]byte(cacheKeySeparator))
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// 隔离校验失败的缓存文件并记录安全事件
+func (fs *FileCacheSecretStoreStrategy) quarantine(cacheSecretPath, fileName string, cause error) {
+	filePath := filepath.Join(cacheSecretPath, fileName)
+	quarantinePath := filePath + quarantineFileSuffix + strconv.FormatInt(time.Now().UnixNano()/1e6, 10)
+	if err := os.Rename(filePath, quarantinePath); err != nil {
+		logger.GetCommonLogger(utils.ModeName).Errorf("action:quarantineCacheFile, security event: cache file [%s] failed verification, cause:%s, quarantine failed:%s", filePath, cause.Error(), err.Error())
+		return
+	}
+	logger.GetCommonLogger(utils.ModeName).Errorf("action:quarantineCacheFile, security event: cache file [%s] failed verification and was quarantined to [%s], cause:%s", filePath, quarantinePath, cause.Error())
+}
+
+// 获取凭据缓存文件所在目录及文件名，凭据名称及stage不能访问缓存目录之外的路径
+func (fs *FileCacheSecretStoreStrategy) getCacheSecretFile(secretName, stage string) (string, string, error) {
+	if err := utils.ValidateRelativePath(secretName); err != nil {
+		return "", "", err
+	}
+	if strings.ContainsAny(stage, "/\\") || strings.ContainsRune(stage, 0) {
+		return "", "", fmt.Errorf("invalid stage [%s]: %w", stage, utils.ErrInvalidArgument)
+	}
+	return filepath.Join(fs.CacheSecretPath, secretName), getCacheFileName(stage), nil
 }
 
 func (fs *FileCacheSecretStoreStrategy) generateRandomKey() ([]byte, error) {
@@ -171,6 +490,9 @@ func (fs *FileCacheSecretStoreStrategy) generateRandomKey() ([]byte, error) {
 }
 
 func (fs *FileCacheSecretStoreStrategy) Close() error {
+	if fs.KeyProvider != nil {
+		return fs.KeyProvider.Close()
+	}
 	return nil
 }
 
@@ -180,21 +502,70 @@ func (ms *MemoryCacheSecretStoreStrategy) Init() error {
 }
 
 func (ms *MemoryCacheSecretStoreStrategy) StoreSecret(cacheSecretInfo *models.CacheSecretInfo) error {
-	ms.CacheSecretInfoMap.Set(cacheSecretInfo.SecretInfo.SecretName, cacheSecretInfo)
+	ms.CacheSecretInfoMap.Set(getCacheKey(cacheSecretInfo.SecretInfo.SecretName, cacheSecretInfo.Stage), cacheSecretInfo)
 	return nil
 }
 
+// 获取ACSCurrent的secret缓存信息
 func (ms *MemoryCacheSecretStoreStrategy) GetCacheSecretInfo(secretName string) (*models.CacheSecretInfo, error) {
-	if cacheSecretInfoI, ok := ms.CacheSecretInfoMap.Get(secretName); ok {
+	return ms.GetCacheSecretInfoByStage(secretName, utils.StageAcsCurrent)
+}
+
+func (ms *MemoryCacheSecretStoreStrategy) GetCacheSecretInfoByStage(secretName, stage string) (*models.CacheSecretInfo, error) {
+	if cacheSecretInfoI, ok := ms.CacheSecretInfoMap.Get(getCacheKey(secretName, stage)); ok {
 		if cacheSecretInfo, okk := cacheSecretInfoI.(*models.CacheSecretInfo); okk {
 			return cacheSecretInfo, nil
 		} else {
 			return nil, errors.New(fmt.Sprintf("invalid type [CacheSecretInfo]"))
 		}
 	}
-	return nil, errors.New(fmt.Sprintf("invalid cacheSecretInfoMap key [%s]", secretName))
+	return nil, errors.New(fmt.Sprintf("invalid cacheSecretInfoMap key [%s] with stage [%s]", secretName, stage))
+}
+
+func (ms *MemoryCacheSecretStoreStrategy) RemoveSecret(secretName string) error {
+	for _, cacheKey := range getSecretCacheKeys(ms.CacheSecretInfoMap, secretName) {
+		ms.CacheSecretInfoMap.Remove(cacheKey)
+	}
+	return nil
 }
 
 func (ms *MemoryCacheSecretStoreStrategy) Close() error {
 	return nil
 }
+
+// stage为空时使用ACSCurrent，stage不区分大小写
+func normalizeStage(stage string) string {
+	if stage == "" {
+		stage = utils.StageAcsCurrent
+	}
+	return strings.ToLower(stage)
+}
+
+// 缓存key由凭据名称及stage组成
+func getCacheKey(secretName, stage string) string {
+	return secretName + cacheKeySeparator + normalizeStage(stage)
+}
+
+func isSecretCacheKey(cacheKey, secretName string) bool {
+	return strings.HasPrefix(cacheKey, secretName+cacheKeySeparator)
+}
+
+// 获取凭据所有stage的缓存key
+func getSecretCacheKeys(cacheSecretInfoMap cmap.ConcurrentMap, secretName string) []string {
+	var cacheKeys []string
+	for _, cacheKey := range cacheSecretInfoMap.Keys() {
+		if isSecretCacheKey(cacheKey, secretName) {
+			cacheKeys = append(cacheKeys, cacheKey)
+		}
+	}
+	return cacheKeys
+}
+
+// 附加认证数据由凭据名称及stage组成，防止缓存文件被替换为其他凭据或stage的文件
+func getAdditionalData(secretName, stage string) []byte {
+	return []byte(getCacheKey(secretName, stage))
+}
+
+func getCacheFileName(stage string) string {
+	return JsonFileNamePrefix + normalizeStage(stage) + JsonFileNameSuffix
+}
@@ -0,0 +1,361 @@
+package cache
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/models"
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/utils"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const stageAcsPrevious = "ACSPrevious"
+
+// 未指定KeyProvider的文件缓存使用环境变量中的主密钥
+func TestMain(m *testing.M) {
+	masterKey := make([]byte, utils.RandomKeyLength)
+	if _, err := rand.Read(masterKey); err != nil {
+		panic(err)
+	}
+	os.Setenv(utils.EnvCacheMasterKeyKey, base64.StdEncoding.EncodeToString(masterKey))
+	os.Exit(m.Run())
+}
+
+func newCacheSecretInfo(secretName, versionId, secretValue, stage string) *models.CacheSecretInfo {
+	return &models.CacheSecretInfo{
+		SecretInfo: &models.SecretInfo{
+			SecretName:     secretName,
+			VersionId:      versionId,
+			SecretValue:    secretValue,
+			SecretDataType: utils.TextDataType,
+		},
+		Stage:            stage,
+		RefreshTimestamp: time.Now().UnixNano() / 1e6,
+	}
+}
+
+func newTempCachePath(t *testing.T) string {
+	cacheSecretPath, err := ioutil.TempDir("", "secret_cache")
+	assert.Nil(t, err)
+	return cacheSecretPath
+}
+
+func TestFileCacheSecretStoreStrategy_Stages(t *testing.T) {
+	cacheSecretPath := newTempCachePath(t)
+	defer os.RemoveAll(cacheSecretPath)
+	store := NewFileCacheSecretStoreStrategy(cacheSecretPath, true, "salt")
+	assert.Nil(t, store.Init())
+
+	assert.Nil(t, store.StoreSecret(newCacheSecretInfo("secret", "v2", "value2", utils.StageAcsCurrent)))
+	assert.Nil(t, store.StoreSecret(newCacheSecretInfo("secret", "v1", "value1", stageAcsPrevious)))
+	assert.True(t, utils.FileExists(filepath.Join(cacheSecretPath, "secret"), "stage_acscurrent.json"))
+	assert.True(t, utils.FileExists(filepath.Join(cacheSecretPath, "secret"), "stage_acsprevious.json"))
+
+	cacheSecretInfo, err := store.GetCacheSecretInfoByStage("secret", utils.StageAcsCurrent)
+	assert.Nil(t, err)
+	assert.Equal(t, "value2", cacheSecretInfo.SecretInfo.SecretValue)
+	cacheSecretInfo, err = store.GetCacheSecretInfoByStage("secret", stageAcsPrevious)
+	assert.Nil(t, err)
+	assert.Equal(t, "value1", cacheSecretInfo.SecretInfo.SecretValue)
+	// stage为空时使用ACSCurrent
+	cacheSecretInfo, err = store.GetCacheSecretInfoByStage("secret", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", cacheSecretInfo.SecretInfo.VersionId)
+}
+
+func TestFileCacheSecretStoreStrategy_ReloadCustomStage(t *testing.T) {
+	cacheSecretPath := newTempCachePath(t)
+	defer os.RemoveAll(cacheSecretPath)
+	store := NewFileCacheSecretStoreStrategy(cacheSecretPath, true, "salt")
+	assert.Nil(t, store.Init())
+	assert.Nil(t, store.StoreSecret(newCacheSecretInfo("secret", "v1", "value1", stageAcsPrevious)))
+	assert.Nil(t, store.Close())
+
+	// 模拟重启后从文件加载
+	reloaded := NewFileCacheSecretStoreStrategy(cacheSecretPath, true, "salt")
+	assert.Nil(t, reloaded.Init())
+	cacheSecretInfo, err := reloaded.GetCacheSecretInfoByStage("secret", stageAcsPrevious)
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", cacheSecretInfo.SecretInfo.VersionId)
+	assert.Equal(t, "value1", cacheSecretInfo.SecretInfo.SecretValue)
+	assert.Equal(t, stageAcsPrevious, cacheSecretInfo.Stage)
+	_, err = reloaded.GetCacheSecretInfoByStage("secret", utils.StageAcsCurrent)
+	assert.NotNil(t, err)
+
+	// 不允许启动时加载则忽略文件
+	notReloaded := NewFileCacheSecretStoreStrategy(cacheSecretPath, false, "salt")
+	assert.Nil(t, notReloaded.Init())
+	_, err = notReloaded.GetCacheSecretInfoByStage("secret", stageAcsPrevious)
+	assert.NotNil(t, err)
+}
+
+func TestFileCacheSecretStoreStrategy_RemoveSecret(t *testing.T) {
+	cacheSecretPath := newTempCachePath(t)
+	defer os.RemoveAll(cacheSecretPath)
+	store := NewFileCacheSecretStoreStrategy(cacheSecretPath, false, "salt")
+	assert.Nil(t, store.Init())
+	assert.Nil(t, store.StoreSecret(newCacheSecretInfo("secret", "v2", "value2", utils.StageAcsCurrent)))
+	assert.Nil(t, store.StoreSecret(newCacheSecretInfo("secret", "v1", "value1", stageAcsPrevious)))
+	assert.Nil(t, store.StoreSecret(newCacheSecretInfo("secret2", "v1", "value1", utils.StageAcsCurrent)))
+
+	assert.Nil(t, store.RemoveSecret("secret"))
+	_, err := store.GetCacheSecretInfoByStage("secret", utils.StageAcsCurrent)
+	assert.NotNil(t, err)
+	_, err = store.GetCacheSecretInfoByStage("secret", stageAcsPrevious)
+	assert.NotNil(t, err)
+	assert.False(t, utils.FileExists(filepath.Join(cacheSecretPath, "secret"), "stage_acsprevious.json"))
+	_, err = store.GetCacheSecretInfoByStage("secret2", utils.StageAcsCurrent)
+	assert.Nil(t, err)
+}
+
+func TestMemoryCacheSecretStoreStrategy_Stages(t *testing.T) {
+	store := NewMemoryCacheSecretStoreStrategy()
+	assert.Nil(t, store.Init())
+	assert.Nil(t, store.StoreSecret(newCacheSecretInfo("secret", "v2", "value2", utils.StageAcsCurrent)))
+	assert.Nil(t, store.StoreSecret(newCacheSecretInfo("secret", "v1", "value1", stageAcsPrevious)))
+
+	cacheSecretInfo, err := store.GetCacheSecretInfoByStage("secret", stageAcsPrevious)
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", cacheSecretInfo.SecretInfo.VersionId)
+	cacheSecretInfo, err = store.GetCacheSecretInfoByStage("secret", utils.StageAcsCurrent)
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", cacheSecretInfo.SecretInfo.VersionId)
+
+	assert.Nil(t, store.RemoveSecret("secret"))
+	_, err = store.GetCacheSecretInfoByStage("secret", stageAcsPrevious)
+	assert.NotNil(t, err)
+}
+
+// 使用aes256-cbc格式加密，模拟旧版本写入的缓存文件
+func encryptSecretValueCbc(t *testing.T, secretValue, salt string) string {
+	key := make([]byte, utils.RandomKeyLength)
+	iv := make([]byte, utils.IvLength)
+	_, err := rand.Read(key)
+	assert.Nil(t, err)
+	_, err = rand.Read(iv)
+	assert.Nil(t, err)
+	cipherData, err := utils.EncryptAes256Cbc([]byte(secretValue), key, iv, []byte(salt))
+	assert.Nil(t, err)
+	encrypted := append(append(append([]byte(utils.Aes256CbcModeKey), key...), iv...), cipherData...)
+	return base64.StdEncoding.EncodeToString(encrypted)
+}
+
+func TestFileCacheSecretStoreStrategy_ReadCbcFile(t *testing.T) {
+	cacheSecretPath := newTempCachePath(t)
+	defer os.RemoveAll(cacheSecretPath)
+	cacheSecretInfo := newCacheSecretInfo("secret", "v1", encryptSecretValueCbc(t, "value1", "salt"), utils.StageAcsCurrent)
+	assert.Nil(t, utils.WriteJsonObject(filepath.Join(cacheSecretPath, "secret"), "stage_acscurrent.json", cacheSecretInfo))
+
+	// 禁止迁移时拒绝读取但不隔离
+	disabledStore := NewFileCacheSecretStoreStrategy(cacheSecretPath, true, "salt").WithLegacyMigration(false)
+	assert.Nil(t, disabledStore.Init())
+	_, err := disabledStore.GetCacheSecretInfoByStage("secret", utils.StageAcsCurrent)
+	assert.NotNil(t, err)
+	assert.False(t, errors.Is(err, utils.ErrCacheIntegrity))
+	assert.True(t, utils.FileExists(filepath.Join(cacheSecretPath, "secret"), "stage_acscurrent.json"))
+
+	// 默认迁移旧版本写入的缓存文件
+	store := NewFileCacheSecretStoreStrategy(cacheSecretPath, true, "salt")
+	assert.Nil(t, store.Init())
+	reloaded, err := store.GetCacheSecretInfoByStage("secret", utils.StageAcsCurrent)
+	assert.Nil(t, err)
+	assert.Equal(t, "value1", reloaded.SecretInfo.SecretValue)
+	assert.Equal(t, int64(0), reloaded.RefreshTimestamp)
+
+	// 旧格式缓存文件读取后使用包装后的数据密钥重新加密并附加完整性校验值写入，并视为已过期
+	entry, migrated := readCacheSecretEntry(t, cacheSecretPath, "secret")
+	assert.NotEqual(t, "", entry.Mac)
+	assert.Equal(t, int64(0), migrated.RefreshTimestamp)
+	assertEncryptionMode(t, migrated, utils.Aes256GcmEnvelopeModeKey)
+	reloadStore := NewFileCacheSecretStoreStrategy(cacheSecretPath, true, "salt")
+	assert.Nil(t, reloadStore.Init())
+	reloaded, err = reloadStore.GetCacheSecretInfoByStage("secret", utils.StageAcsCurrent)
+	assert.Nil(t, err)
+	assert.Equal(t, "value1", reloaded.SecretInfo.SecretValue)
+}
+
+func assertEncryptionMode(t *testing.T, cacheSecretInfo *models.CacheSecretInfo, mode string) {
+	decodeBytes, err := base64.StdEncoding.DecodeString(cacheSecretInfo.SecretInfo.SecretValue)
+	assert.Nil(t, err)
+	assert.Equal(t, mode, string(decodeBytes[:len(mode)]))
+}
+
+func TestFileCacheSecretStoreStrategy_DefaultKeyProvider(t *testing.T) {
+	cacheSecretPath := newTempCachePath(t)
+	defer os.RemoveAll(cacheSecretPath)
+	store := NewFileCacheSecretStoreStrategy(cacheSecretPath, true, "salt")
+	assert.Nil(t, store.Init())
+	assert.Nil(t, store.StoreSecret(newCacheSecretInfo("secret", "v1", "value1", utils.StageAcsCurrent)))
+	_, fileCacheSecretInfo := readCacheSecretEntry(t, cacheSecretPath, "secret")
+	assertEncryptionMode(t, fileCacheSecretInfo, utils.Aes256GcmEnvelopeModeKey)
+
+	// 未指定KeyProvider且环境变量中没有主密钥时使用由salt派生的密钥包装，数据密钥仍不与密文一同明文存储
+	masterKey := os.Getenv(utils.EnvCacheMasterKeyKey)
+	os.Unsetenv(utils.EnvCacheMasterKeyKey)
+	defer os.Setenv(utils.EnvCacheMasterKeyKey, masterKey)
+	saltPath := newTempCachePath(t)
+	defer os.RemoveAll(saltPath)
+	saltStore := NewFileCacheSecretStoreStrategy(saltPath, true, "salt")
+	assert.Nil(t, saltStore.Init())
+	assert.Nil(t, saltStore.StoreSecret(newCacheSecretInfo("secret", "v1", "value1", utils.StageAcsCurrent)))
+	_, fileCacheSecretInfo = readCacheSecretEntry(t, saltPath, "secret")
+	assertEncryptionMode(t, fileCacheSecretInfo, utils.Aes256GcmEnvelopeModeKey)
+
+	reloadStore := NewFileCacheSecretStoreStrategy(saltPath, true, "salt")
+	assert.Nil(t, reloadStore.Init())
+	cacheSecretInfo, err := reloadStore.GetCacheSecretInfoByStage("secret", utils.StageAcsCurrent)
+	assert.Nil(t, err)
+	assert.Equal(t, "value1", cacheSecretInfo.SecretInfo.SecretValue)
+	otherSaltStore := NewFileCacheSecretStoreStrategy(saltPath, true, "other_salt")
+	assert.Nil(t, otherSaltStore.Init())
+	_, err = otherSaltStore.GetCacheSecretInfoByStage("secret", utils.StageAcsCurrent)
+	assert.NotNil(t, err)
+}
+
+func readCacheSecretEntry(t *testing.T, cacheSecretPath, secretName string) (*fileCacheSecretEntry, *models.CacheSecretInfo) {
+	var entry *fileCacheSecretEntry
+	assert.Nil(t, utils.ReadJsonObject(filepath.Join(cacheSecretPath, secretName), "stage_acscurrent.json", &entry))
+	var cacheSecretInfo *models.CacheSecretInfo
+	assert.Nil(t, json.Unmarshal(entry.CacheSecretInfo, &cacheSecretInfo))
+	return entry, cacheSecretInfo
+}
+
+func assertQuarantined(t *testing.T, cacheSecretPath, secretName string) {
+	fileNames, err := filepath.Glob(filepath.Join(cacheSecretPath, secretName, "stage_acscurrent.json"+quarantineFileSuffix+"*"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(fileNames))
+	assert.False(t, utils.FileExists(filepath.Join(cacheSecretPath, secretName), "stage_acscurrent.json"))
+	for _, fileName := range fileNames {
+		assert.Nil(t, os.Remove(fileName))
+	}
+}
+
+func TestFileCacheSecretStoreStrategy_Tampered(t *testing.T) {
+	cacheSecretPath := newTempCachePath(t)
+	defer os.RemoveAll(cacheSecretPath)
+	store := NewFileCacheSecretStoreStrategy(cacheSecretPath, true, "salt")
+	assert.Nil(t, store.Init())
+	assert.Nil(t, store.StoreSecret(newCacheSecretInfo("secret", "v1", "value1", utils.StageAcsCurrent)))
+	assert.Nil(t, store.StoreSecret(newCacheSecretInfo("secret2", "v1", "value2", utils.StageAcsCurrent)))
+	reloaded := NewFileCacheSecretStoreStrategy(cacheSecretPath, true, "salt")
+	assert.Nil(t, reloaded.Init())
+
+	// 将secret2的缓存文件替换为secret的缓存文件
+	entry, cacheSecretInfo := readCacheSecretEntry(t, cacheSecretPath, "secret")
+	assert.Nil(t, utils.WriteJsonObject(filepath.Join(cacheSecretPath, "secret2"), "stage_acscurrent.json", entry))
+	_, err := reloaded.GetCacheSecretInfoByStage("secret2", utils.StageAcsCurrent)
+	assert.True(t, errors.Is(err, utils.ErrCacheIntegrity))
+	assertQuarantined(t, cacheSecretPath, "secret2")
+
+	// 篡改明文字段
+	cacheSecretInfo.RefreshTimestamp = time.Now().Add(time.Hour).UnixNano() / 1e6
+	data, err := json.Marshal(cacheSecretInfo)
+	assert.Nil(t, err)
+	assert.Nil(t, utils.WriteJsonObject(filepath.Join(cacheSecretPath, "secret"), "stage_acscurrent.json", &fileCacheSecretEntry{CacheSecretInfo: data, MacKey: entry.MacKey, Mac: entry.Mac}))
+	_, err = reloaded.GetCacheSecretInfoByStage("secret", utils.StageAcsCurrent)
+	assert.True(t, errors.Is(err, utils.ErrCacheIntegrity))
+	assertQuarantined(t, cacheSecretPath, "secret")
+
+	// 旧格式的缓存文件只能为aes256-cbc格式，去掉完整性校验值的新格式缓存文件被隔离
+	assert.Nil(t, utils.WriteJsonObject(filepath.Join(cacheSecretPath, "secret"), "stage_acscurrent.json", cacheSecretInfo))
+	_, err = reloaded.GetCacheSecretInfoByStage("secret", utils.StageAcsCurrent)
+	assert.True(t, errors.Is(err, utils.ErrCacheIntegrity))
+	assertQuarantined(t, cacheSecretPath, "secret")
+
+	// 既不是旧格式也没有完整性校验值的文件被隔离
+	assert.Nil(t, utils.WriteJsonObject(filepath.Join(cacheSecretPath, "secret"), "stage_acscurrent.json", map[string]string{"stage": utils.StageAcsCurrent}))
+	_, err = reloaded.GetCacheSecretInfoByStage("secret", utils.StageAcsCurrent)
+	assert.True(t, errors.Is(err, utils.ErrCacheIntegrity))
+	assertQuarantined(t, cacheSecretPath, "secret")
+
+	// 截断的密文返回错误而不是panic
+	cacheSecretInfo.SecretInfo.SecretValue = base64.StdEncoding.EncodeToString([]byte(utils.Aes256GcmEnvelopeModeKey + "short"))
+	assert.Nil(t, store.writeCacheSecretFile(filepath.Join(cacheSecretPath, "secret"), "stage_acscurrent.json", getCacheKey("secret", utils.StageAcsCurrent), cacheSecretInfo))
+	_, err = reloaded.GetCacheSecretInfoByStage("secret", utils.StageAcsCurrent)
+	assert.NotNil(t, err)
+}
+
+func TestFileCacheSecretStoreStrategy_ForgedMac(t *testing.T) {
+	cacheSecretPath := newTempCachePath(t)
+	defer os.RemoveAll(cacheSecretPath)
+	store := NewFileCacheSecretStoreStrategy(cacheSecretPath, true, "salt")
+	assert.Nil(t, store.Init())
+	assert.Nil(t, store.StoreSecret(newCacheSecretInfo("secret", "v1", "value1", utils.StageAcsCurrent)))
+	reloaded := NewFileCacheSecretStoreStrategy(cacheSecretPath, true, "salt")
+	assert.Nil(t, reloaded.Init())
+	entry, cacheSecretInfo := readCacheSecretEntry(t, cacheSecretPath, "secret")
+	cacheKey := getCacheKey("secret", utils.StageAcsCurrent)
+	cacheSecretInfo.RefreshTimestamp = time.Now().Add(time.Hour).UnixNano() / 1e6
+	data, err := json.Marshal(cacheSecretInfo)
+	assert.Nil(t, err)
+
+	// 知道salt的攻击者使用salt派生的密钥重新计算完整性校验值
+	saltKey := pbkdf2.Key([]byte("salt"), []byte("secret_cache_integrity"), utils.IterationCount, utils.KeyLength, sha256.New)
+	forged := &fileCacheSecretEntry{CacheSecretInfo: data, Mac: base64.StdEncoding.EncodeToString(computeMac(saltKey, cacheKey, data))}
+	assert.Nil(t, utils.WriteJsonObject(filepath.Join(cacheSecretPath, "secret"), "stage_acscurrent.json", forged))
+	_, err = reloaded.GetCacheSecretInfoByStage("secret", utils.StageAcsCurrent)
+	assert.True(t, errors.Is(err, utils.ErrCacheIntegrity))
+	assertQuarantined(t, cacheSecretPath, "secret")
+
+	// 沿用原完整性校验密钥的包装结果，但无法得到原完整性校验密钥
+	forged = &fileCacheSecretEntry{CacheSecretInfo: data, MacKey: entry.MacKey, Mac: base64.StdEncoding.EncodeToString(computeMac(saltKey, cacheKey, data))}
+	assert.Nil(t, utils.WriteJsonObject(filepath.Join(cacheSecretPath, "secret"), "stage_acscurrent.json", forged))
+	_, err = reloaded.GetCacheSecretInfoByStage("secret", utils.StageAcsCurrent)
+	assert.True(t, errors.Is(err, utils.ErrCacheIntegrity))
+	assertQuarantined(t, cacheSecretPath, "secret")
+
+	// salt相同但KeyProvider不同的缓存策略写入的文件无法通过校验
+	os.Setenv(testMasterKeyEnv, newMasterKey(t))
+	defer os.Unsetenv(testMasterKeyEnv)
+	attacker := NewFileCacheSecretStoreStrategy(cacheSecretPath, true, "salt").
+		WithKeyProvider(NewEnvMasterKeyCacheKeyProvider(testMasterKeyEnv))
+	assert.Nil(t, attacker.Init())
+	assert.Nil(t, attacker.StoreSecret(cacheSecretInfo))
+	_, err = attacker.GetCacheSecretInfoByStage("secret", utils.StageAcsCurrent)
+	assert.Nil(t, err)
+	_, err = reloaded.GetCacheSecretInfoByStage("secret", utils.StageAcsCurrent)
+	assert.NotNil(t, err)
+
+	// 开启迁移时也不接受缺少完整性校验密钥的文件
+	legacyStore := NewFileCacheSecretStoreStrategy(cacheSecretPath, true, "salt").WithLegacyMigration(true)
+	assert.Nil(t, legacyStore.Init())
+	assert.Nil(t, store.StoreSecret(newCacheSecretInfo("secret", "v1", "value1", utils.StageAcsCurrent)))
+	entry, _ = readCacheSecretEntry(t, cacheSecretPath, "secret")
+	forged = &fileCacheSecretEntry{CacheSecretInfo: entry.CacheSecretInfo, Mac: base64.StdEncoding.EncodeToString(computeMac(saltKey, cacheKey, entry.CacheSecretInfo))}
+	assert.Nil(t, utils.WriteJsonObject(filepath.Join(cacheSecretPath, "secret"), "stage_acscurrent.json", forged))
+	_, err = legacyStore.GetCacheSecretInfoByStage("secret", utils.StageAcsCurrent)
+	assert.True(t, errors.Is(err, utils.ErrCacheIntegrity))
+	assertQuarantined(t, cacheSecretPath, "secret")
+}
+
+func TestFileCacheSecretStoreStrategy_InvalidPath(t *testing.T) {
+	cacheSecretPath := newTempCachePath(t)
+	defer os.RemoveAll(cacheSecretPath)
+	store := NewFileCacheSecretStoreStrategy(cacheSecretPath, true, "salt")
+	assert.Nil(t, store.Init())
+
+	err := store.StoreSecret(newCacheSecretInfo("../secret", "v1", "value1", utils.StageAcsCurrent))
+	assert.True(t, errors.Is(err, utils.ErrInvalidArgument))
+	assert.False(t, utils.FileExists(filepath.Dir(cacheSecretPath), "secret"))
+	err = store.StoreSecret(newCacheSecretInfo("secret", "v1", "value1", "../stage"))
+	assert.True(t, errors.Is(err, utils.ErrInvalidArgument))
+	_, err = store.GetCacheSecretInfoByStage("app/../../secret", utils.StageAcsCurrent)
+	assert.True(t, errors.Is(err, utils.ErrInvalidArgument))
+	assert.True(t, errors.Is(store.RemoveSecret(".."), utils.ErrInvalidArgument))
+
+	// 凭据名称允许包含/
+	assert.Nil(t, store.StoreSecret(newCacheSecretInfo("app/secret", "v1", "value1", utils.StageAcsCurrent)))
+	cacheSecretInfo, err := store.GetCacheSecretInfoByStage("app/secret", utils.StageAcsCurrent)
+	assert.Nil(t, err)
+	assert.Equal(t, "value1", cacheSecretInfo.SecretInfo.SecretValue)
+}
@@ -5,6 +5,7 @@ import "github.com/aliyun/alibaba-cloud-sdk-go/sdk/auth"
 type CredentialsProperties struct {
 	Credential       auth.Credential
 	SecretNameSlice  []string
+	SecretTTLMap     map[string]int64
 	RegionInfoSlice  []*RegionInfo
 	SourceProperties map[string]string
 
@@ -12,6 +12,8 @@ type SecretInfo struct {
 	ExtendedConfig        string `json:"extendedConfig"`
 	RotationInterval      string `json:"rotationInterval"`
 	NextRotationDate      string `json:"nextRotationDate"`
+	// 是否为KMS不可用时从容灾数据恢复的凭据
+	Recovered bool `json:"recovered"`
 }
 
 func (si *SecretInfo) Clone() *SecretInfo {
@@ -27,5 +29,6 @@ func (si *SecretInfo) Clone() *SecretInfo {
 		ExtendedConfig:        si.ExtendedConfig,
 		RotationInterval:      si.RotationInterval,
 		NextRotationDate:      si.NextRotationDate,
+		Recovered:             si.Recovered,
 	}
 }
@@ -0,0 +1,108 @@
+package sdk
+
+import (
+	"reflect"
+
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/logger"
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/models"
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/utils"
+)
+
+// SecretChangeListener 凭据变更监听器，回调在刷新流程释放凭据锁后同步执行，回调中可再次调用Client，请勿长时间阻塞
+type SecretChangeListener interface {
+	// 定时刷新或强制刷新获取到的凭据版本或内容与缓存不一致时回调
+	OnSecretChanged(oldSecretInfo, newSecretInfo *models.SecretInfo)
+
+	// 凭据刷新失败时回调
+	OnRefreshFailed(secretName string, err error)
+}
+
+type secretChangeListenerEntry struct {
+	id       int64
+	listener SecretChangeListener
+}
+
+// 添加凭据变更监听器，返回的监听器ID可用于RemoveSecretChangeListenerById，listener为nil时返回0
+func (scc *SecretManagerCacheClient) AddSecretChangeListener(listener SecretChangeListener) int64 {
+	if listener == nil {
+		return 0
+	}
+	scc.listenerMtx.Lock()
+	defer scc.listenerMtx.Unlock()
+	scc.listenerSeq++
+	scc.listeners = append(scc.listeners, &secretChangeListenerEntry{id: scc.listenerSeq, listener: listener})
+	return scc.listenerSeq
+}
+
+// 按监听器ID移除凭据变更监听器
+func (scc *SecretManagerCacheClient) RemoveSecretChangeListenerById(id int64) {
+	scc.removeListeners(func(entry *secretChangeListenerEntry) bool {
+		return entry.id == id
+	})
+}
+
+// 移除凭据变更监听器，按值比较，仅对可比较类型(如指针接收者)生效，函数或包含slice、map字段的结构体等不可比较类型请使用RemoveSecretChangeListenerById
+func (scc *SecretManagerCacheClient) RemoveSecretChangeListener(listener SecretChangeListener) {
+	if listener == nil || !reflect.TypeOf(listener).Comparable() {
+		return
+	}
+	scc.removeListeners(func(entry *secretChangeListenerEntry) bool {
+		return reflect.TypeOf(entry.listener) == reflect.TypeOf(listener) && entry.listener == listener
+	})
+}
+
+func (scc *SecretManagerCacheClient) removeListeners(match func(entry *secretChangeListenerEntry) bool) {
+	scc.listenerMtx.Lock()
+	defer scc.listenerMtx.Unlock()
+	listeners := make([]*secretChangeListenerEntry, 0, len(scc.listeners))
+	for _, entry := range scc.listeners {
+		if !match(entry) {
+			listeners = append(listeners, entry)
+		}
+	}
+	scc.listeners = listeners
+}
+
+func (scc *SecretManagerCacheClient) getListeners() []*secretChangeListenerEntry {
+	scc.listenerMtx.RLock()
+	defer scc.listenerMtx.RUnlock()
+	return scc.listeners
+}
+
+func (scc *SecretManagerCacheClient) notifySecretChanged(secretName string, oldSecretInfo, newSecretInfo *models.SecretInfo) {
+	if oldSecretInfo == nil || newSecretInfo == nil {
+		return
+	}
+	if oldSecretInfo.VersionId == newSecretInfo.VersionId && oldSecretInfo.SecretValue == newSecretInfo.SecretValue {
+		return
+	}
+	oldSecretInfo, newSecretInfo = oldSecretInfo.Clone(), newSecretInfo.Clone()
+	scc.deferNotify(secretName, func() {
+		for _, entry := range scc.getListeners() {
+			listener := entry.listener
+			safeNotify("onSecretChanged", func() {
+				listener.OnSecretChanged(oldSecretInfo.Clone(), newSecretInfo.Clone())
+			})
+		}
+	})
+}
+
+func (scc *SecretManagerCacheClient) notifyRefreshFailed(secretName string, err error) {
+	scc.deferNotify(secretName, func() {
+		for _, entry := range scc.getListeners() {
+			listener := entry.listener
+			safeNotify("onRefreshFailed", func() {
+				listener.OnRefreshFailed(secretName, err)
+			})
+		}
+	})
+}
+
+func safeNotify(action string, fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.GetCommonLogger(utils.ModeName).Errorf("action:%s, listener panic:%v", action, r)
+		}
+	}()
+	fn()
+}
@@ -1,8 +1,10 @@
 package sdk
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"os"
 	"sync"
 	"time"
 
@@ -12,7 +14,6 @@ import (
 	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/service"
 	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/utils"
 
-	sdkerr "github.com/aliyun/alibaba-cloud-sdk-go/sdk/errors"
 	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
 	"github.com/aliyun/alibaba-cloud-sdk-go/services/kms"
 	cmap "github.com/orcaman/concurrent-map"
@@ -22,6 +23,10 @@ const (
 	// defaultTtl 默认TTL时间
 	defaultTtl                 int64 = 60 * 60 * 1000
 	defaultJsonTtlPropertyName       = "ttl"
+	// defaultMaxConcurrency 批量获取凭据的默认并发数
+	defaultMaxConcurrency = 8
+	// defaultCloseTimeout Close等待进行中的刷新完成的最长时间，单位ms
+	defaultCloseTimeout = 30 * 1000
 )
 
 type SecretManagerCacheClient struct {
@@ -32,19 +37,55 @@ type SecretManagerCacheClient struct {
 	refreshSecretStrategy    service.RefreshSecretStrategy
 	cacheHook                cache.SecretCacheHook
 	secretTTLMap             map[string]int64
+	secretTTLMtx             sync.RWMutex
+	maxConcurrency           int
+	customConfigFile         string
 
-	scheduledMap     cmap.ConcurrentMap
-	secretNameMtx    sync.Mutex
-	secretNameMtxMap map[string]*sync.Mutex
+	scheduledMap cmap.ConcurrentMap
+	// 按版本号或非缓存stage获取的凭据，key由凭据名称及版本号或stage组成
+	versionCache *versionCache
+	// 凭据锁，key为凭据名称或版本缓存key
+	secretLockMtx sync.Mutex
+	secretLockMap map[string]*secretLock
+	// Unwatch序号，用于判断等待凭据锁期间凭据是否被取消监听
+	unwatchSeq int64
+
+	listenerMtx sync.RWMutex
+	listeners   []*secretChangeListenerEntry
+	listenerSeq int64
+
+	// 缓存过期后是否先返回旧值并在后台刷新
+	staleWhileRevalidate bool
+	// 过期后允许返回旧值的最长时间，单位MS，小于等于0表示不限制
+	maxStaleness int64
+	revalidating sync.Map
+
+	ctx      context.Context
+	cancel   context.CancelFunc
+	closeMtx sync.RWMutex
+	closed   bool
+	inflight sync.WaitGroup
 }
 
-type runnable interface {
-	getRunnable() func()
+// secretLock 凭据锁，使用容量为1的channel以支持ctx取消等待，refs为持有及等待该锁的数量，为0时从map中删除
+type secretLock struct {
+	ch   chan struct{}
+	refs int
+	// 最近一次Unwatch的序号
+	unwatchSeq int64
+	// 持锁期间产生的监听器回调，释放锁后执行
+	pendingNotifies []func()
+}
+
+// 可获取配置文件路径的SecretManagerClient
+type customConfigFileProvider interface {
+	GetCustomConfigFile() string
 }
 
 type refreshSecretTask struct {
 	client     *SecretManagerCacheClient
 	secretName string
+	timer      *time.Timer
 }
 
 func NewSecretCacheClient() *SecretManagerCacheClient {
@@ -52,12 +93,17 @@ func NewSecretCacheClient() *SecretManagerCacheClient {
 		jsonTTLPropertyName: defaultJsonTtlPropertyName,
 		stage:               utils.StageAcsCurrent,
 		secretTTLMap:        make(map[string]int64),
+		maxConcurrency:      defaultMaxConcurrency,
 		scheduledMap:        cmap.New(),
-		secretNameMtxMap:    make(map[string]*sync.Mutex),
+		versionCache:        newVersionCache(defaultMaxVersionCacheSize),
+		secretLockMap:       make(map[string]*secretLock),
 	}
 }
 
 func (scc *SecretManagerCacheClient) Init() error {
+	if scc.ctx == nil {
+		scc.ctx, scc.cancel = context.WithCancel(context.Background())
+	}
 	if scc.secretManagerClient == nil {
 		scc.secretManagerClient = service.NewDefaultSecretManagerClientBuilder().Build()
 	}
@@ -86,46 +132,108 @@ func (scc *SecretManagerCacheClient) Init() error {
 	if err != nil {
 		return err
 	}
-	for secretName := range scc.secretTTLMap {
-		secretInfo, err := scc.getSecretValue(secretName)
+	err = scc.initSecretNames()
+	if err != nil {
+		return err
+	}
+	errs := scc.forEachSecret(scc.getSecretNames(), func(secretName string) error {
+		secretInfo, err := scc.getSecretValue(scc.ctx, secretName)
 		if err != nil {
 			logger.GetCommonLogger(utils.ModeName).Errorf("action:initSecretCacheClient", err)
 			if scc.judgeSkipRefreshException(err) {
 				return err
 			}
 		}
-		err = scc.storeAndRefresh(secretName, secretInfo)
+		return scc.storeAndRefresh(scc.ctx, secretName, secretInfo)
+	})
+	if len(errs) > 0 {
+		return &utils.BatchError{Errors: errs}
+	}
+	logger.GetCommonLogger(utils.ModeName).Infof("secretCacheClient init success")
+	return nil
+}
+
+// 从配置文件及环境变量secret_names中加载需要预加载并定时刷新的凭据，Builder中指定的TTL优先，
+// 未指定配置文件时使用SecretManagerClient的配置文件
+func (scc *SecretManagerCacheClient) initSecretNames() error {
+	configFile := scc.customConfigFile
+	if configFile == "" {
+		if provider, ok := scc.secretManagerClient.(customConfigFileProvider); ok {
+			configFile = provider.GetCustomConfigFile()
+		}
+	}
+	credentialsProperties, err := utils.LoadSecretNames(configFile)
+	if err != nil {
+		return err
+	}
+	if credentialsProperties != nil {
+		scc.addSecretNames(credentialsProperties.SecretNameSlice, credentialsProperties.SecretTTLMap)
+	}
+	secretNamesEnv := os.Getenv(utils.EnvSecretNamesKey)
+	if secretNamesEnv != "" {
+		secretNames, secretTTLMap, err := utils.ParseSecretNames(secretNamesEnv)
 		if err != nil {
-			return err
+			return utils.NewConfigError(utils.EnvSecretNamesKey, fmt.Sprintf("env param[%s] is illegal, err:%v", utils.EnvSecretNamesKey, err), err)
 		}
+		scc.addSecretNames(secretNames, secretTTLMap)
 	}
-	logger.GetCommonLogger(utils.ModeName).Infof("secretCacheClient init success")
 	return nil
 }
 
+func (scc *SecretManagerCacheClient) addSecretNames(secretNames []string, secretTTLMap map[string]int64) {
+	for _, secretName := range secretNames {
+		if _, ok := scc.getSecretTTL(secretName); ok {
+			continue
+		}
+		ttl, ok := secretTTLMap[secretName]
+		if !ok {
+			ttl = defaultTtl
+		}
+		scc.setSecretTTL(secretName, ttl)
+	}
+}
+
 // 根据凭据名称获取secretInfo信息
 func (scc *SecretManagerCacheClient) GetSecretInfo(secretName string) (*models.SecretInfo, error) {
+	return scc.GetSecretInfoContext(context.Background(), secretName)
+}
+
+// 根据凭据名称获取secretInfo信息，缓存未命中时远程获取凭据受ctx的超时与取消控制
+func (scc *SecretManagerCacheClient) GetSecretInfoContext(ctx context.Context, secretName string) (*models.SecretInfo, error) {
 	if secretName == "" {
-		return nil, errors.New(fmt.Sprintf("the argument secretName must not be empty"))
+		return nil, &utils.SecretError{Message: "the argument secretName must not be empty", Err: utils.ErrInvalidArgument}
 	}
-	cacheSecretInfo, err := scc.cacheSecretStoreStrategy.GetCacheSecretInfo(secretName)
+	if err := scc.acquire(); err != nil {
+		return nil, err
+	}
+	defer scc.release()
+	cacheSecretInfo, err := scc.getCacheSecretInfo(secretName)
 	if err == nil && !scc.judgeCacheExpire(cacheSecretInfo) {
 		return scc.cacheHook.Get(cacheSecretInfo)
+	} else if err == nil && scc.judgeServeStale(cacheSecretInfo) {
+		scc.revalidate(secretName)
+		return scc.cacheHook.Get(cacheSecretInfo)
 	} else {
-		lck := scc.getLock(secretName)
-		lck.Lock()
-		defer lck.Unlock()
-		cacheSecretInfo, err = scc.cacheSecretStoreStrategy.GetCacheSecretInfo(secretName)
+		unwatchSeq := scc.getUnwatchSeq()
+		unlock, err := scc.lockSecret(ctx, secretName)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+		cacheSecretInfo, err = scc.getCacheSecretInfo(secretName)
 		if err == nil && !scc.judgeCacheExpire(cacheSecretInfo) {
 			return scc.cacheHook.Get(cacheSecretInfo)
 		} else {
-			secretInfo, err := scc.getSecretValue(secretName)
+			secretInfo, err := scc.getSecretValue(ctx, secretName)
 			if err != nil {
 				return nil, err
 			}
-			err = scc.storeAndRefreshLocked(secretName, secretInfo)
-			if err != nil {
-				return nil, err
+			// 等待凭据锁期间凭据被取消监听时只返回凭据，不再缓存及加入刷新
+			if !scc.unwatchedSince(secretName, unwatchSeq) {
+				err = scc.storeAndRefreshLocked(ctx, secretName, secretInfo)
+				if err != nil {
+					return nil, err
+				}
 			}
 			cacheSecretInfo, err = scc.cacheHook.Put(secretInfo)
 			if err != nil {
@@ -139,39 +247,167 @@ func (scc *SecretManagerCacheClient) GetSecretInfo(secretName string) (*models.S
 	}
 }
 
+// 批量获取凭据信息，缓存未命中的凭据并发远程获取，部分失败时返回成功的结果及*utils.BatchError
+func (scc *SecretManagerCacheClient) GetSecretInfos(secretNames ...string) (map[string]*models.SecretInfo, error) {
+	return scc.GetSecretInfosContext(context.Background(), secretNames...)
+}
+
+// 批量获取凭据信息，远程获取凭据受ctx的超时与取消控制
+func (scc *SecretManagerCacheClient) GetSecretInfosContext(ctx context.Context, secretNames ...string) (map[string]*models.SecretInfo, error) {
+	var mtx sync.Mutex
+	secretInfos := make(map[string]*models.SecretInfo, len(secretNames))
+	errs := scc.forEachSecret(secretNames, func(secretName string) error {
+		secretInfo, err := scc.GetSecretInfoContext(ctx, secretName)
+		if err != nil {
+			return err
+		}
+		mtx.Lock()
+		defer mtx.Unlock()
+		secretInfos[secretName] = secretInfo
+		return nil
+	})
+	if len(errs) > 0 {
+		return secretInfos, &utils.BatchError{Errors: errs}
+	}
+	return secretInfos, nil
+}
+
+// 并发预加载凭据到缓存，部分失败时返回*utils.BatchError
+func (scc *SecretManagerCacheClient) Prefetch(secretNames ...string) error {
+	return scc.PrefetchContext(context.Background(), secretNames...)
+}
+
+// 并发预加载凭据到缓存，远程获取凭据受ctx的超时与取消控制
+func (scc *SecretManagerCacheClient) PrefetchContext(ctx context.Context, secretNames ...string) error {
+	_, err := scc.GetSecretInfosContext(ctx, secretNames...)
+	return err
+}
+
 // 根据凭据名称获取凭据存储值文本信息
 func (scc *SecretManagerCacheClient) GetStringValue(secretName string) (string, error) {
-	secretInfo, err := scc.GetSecretInfo(secretName)
+	return scc.GetStringValueContext(context.Background(), secretName)
+}
+
+// 根据凭据名称获取凭据存储值文本信息，远程获取凭据受ctx的超时与取消控制
+func (scc *SecretManagerCacheClient) GetStringValueContext(ctx context.Context, secretName string) (string, error) {
+	secretInfo, err := scc.GetSecretInfoContext(ctx, secretName)
 	if err != nil {
 		return "", err
 	}
 	if utils.TextDataType != secretInfo.SecretDataType {
-		return "", errors.New(fmt.Sprintf("the secret named[%s] do not support text value", secretName))
+		return "", &utils.SecretError{
+			SecretName: secretName,
+			Message:    fmt.Sprintf("the secret named[%s] do not support text value", secretName),
+			Err:        utils.ErrSecretTypeMismatch,
+		}
 	}
 	return secretInfo.SecretValue, nil
 }
 
 // 根据凭据名称获取凭据存储的二进制信息
 func (scc *SecretManagerCacheClient) GetBinaryValue(secretName string) ([]byte, error) {
-	secretInfo, err := scc.GetSecretInfo(secretName)
+	return scc.GetBinaryValueContext(context.Background(), secretName)
+}
+
+// 根据凭据名称获取凭据存储的二进制信息，远程获取凭据受ctx的超时与取消控制
+func (scc *SecretManagerCacheClient) GetBinaryValueContext(ctx context.Context, secretName string) ([]byte, error) {
+	secretInfo, err := scc.GetSecretInfoContext(ctx, secretName)
 	if err != nil {
 		return nil, err
 	}
 	if utils.BinaryDataType != secretInfo.SecretDataType {
-		return nil, errors.New(fmt.Sprintf("the secret named[%s] do not support binary value", secretName))
+		return nil, &utils.SecretError{
+			SecretName: secretName,
+			Message:    fmt.Sprintf("the secret named[%s] do not support binary value", secretName),
+			Err:        utils.ErrSecretTypeMismatch,
+		}
 	}
 	return []byte(secretInfo.SecretValue), nil
 }
 
+// 注册需要主动加载并定时刷新的凭据，ttl为刷新间隔，单位MS
+func (scc *SecretManagerCacheClient) Watch(secretName string, ttl int64) error {
+	if secretName == "" {
+		return &utils.SecretError{Message: "the argument secretName must not be empty", Err: utils.ErrInvalidArgument}
+	}
+	if err := scc.acquire(); err != nil {
+		return err
+	}
+	defer scc.release()
+	secretInfo, err := scc.getSecretValue(scc.ctx, secretName)
+	if err != nil {
+		return err
+	}
+	// 获取成功后才设置ttl，失败时恢复原有ttl，避免未监听成功的凭据ttl残留
+	prevTTL, hadTTL := scc.getSecretTTL(secretName)
+	scc.setSecretTTL(secretName, ttl)
+	err = scc.storeAndRefresh(scc.ctx, secretName, secretInfo)
+	if err != nil {
+		if hadTTL {
+			scc.setSecretTTL(secretName, prevTTL)
+		} else {
+			scc.deleteSecretTTL(secretName)
+		}
+	}
+	return err
+}
+
+// 取消凭据的定时刷新并清除缓存，之后再次获取该凭据会重新加入刷新
+func (scc *SecretManagerCacheClient) Unwatch(secretName string) error {
+	if secretName == "" {
+		return &utils.SecretError{Message: "the argument secretName must not be empty", Err: utils.ErrInvalidArgument}
+	}
+	unlock, err := scc.lockSecret(context.Background(), secretName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	scc.markUnwatched(secretName)
+	scc.removeRefreshTask(secretName)
+	scc.deleteSecretTTL(secretName)
+	scc.removeVersionCache(secretName, true)
+	return scc.removeCacheSecret(secretName)
+}
+
 // 强制刷新指定的凭据名称
 func (scc *SecretManagerCacheClient) RefreshNow(secretName string) (bool, error) {
 	if secretName == "" {
-		return false, errors.New(fmt.Sprintf("the argument[%s] must not be null", secretName))
+		return false, &utils.SecretError{Message: "the argument secretName must not be empty", Err: utils.ErrInvalidArgument}
+	}
+	if err := scc.acquire(); err != nil {
+		return false, err
 	}
-	return scc.refreshNow(secretName, nil)
+	defer scc.release()
+	return scc.refreshNow(scc.ctx, secretName, nil)
 }
 
+// 关闭Client，停止所有定时刷新任务并等待进行中的刷新完成，最多等待defaultCloseTimeout
 func (scc *SecretManagerCacheClient) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCloseTimeout*time.Millisecond)
+	defer cancel()
+	return scc.CloseContext(ctx)
+}
+
+// 关闭Client，停止所有定时刷新任务并在ctx截止前等待进行中的刷新完成，重复调用直接返回
+func (scc *SecretManagerCacheClient) CloseContext(ctx context.Context) error {
+	scc.closeMtx.Lock()
+	if scc.closed {
+		scc.closeMtx.Unlock()
+		return nil
+	}
+	scc.closed = true
+	scc.closeMtx.Unlock()
+	for _, secretName := range scc.scheduledMap.Keys() {
+		scc.removeRefreshTask(secretName)
+	}
+	// 进行中的刷新完成或ctx截止后再取消，避免正常完成的刷新被中断
+	err := scc.waitInflight(ctx)
+	if err != nil {
+		logger.GetCommonLogger(utils.ModeName).Errorf("action:waitInflightRefresh", err)
+	}
+	if scc.cancel != nil {
+		scc.cancel()
+	}
 	if scc.cacheSecretStoreStrategy != nil {
 		if err := scc.cacheSecretStoreStrategy.Close(); err != nil {
 			logger.GetCommonLogger(utils.ModeName).Errorf("action:closeCacheSecretStoreStrategy", err)
@@ -192,41 +428,85 @@ func (scc *SecretManagerCacheClient) Close() error {
 			logger.GetCommonLogger(utils.ModeName).Errorf("action:closeCacheHook", err)
 		}
 	}
+	return err
+}
+
+func (scc *SecretManagerCacheClient) acquire() error {
+	scc.closeMtx.RLock()
+	defer scc.closeMtx.RUnlock()
+	if scc.closed {
+		return utils.ErrClientClosed
+	}
+	scc.inflight.Add(1)
 	return nil
 }
 
+func (scc *SecretManagerCacheClient) release() {
+	scc.inflight.Done()
+}
+
+func (scc *SecretManagerCacheClient) waitInflight(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scc.inflight.Wait()
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func (scc *SecretManagerCacheClient) judgeCacheExpire(cacheSecretInfo *models.CacheSecretInfo) bool {
+	return (time.Now().UnixNano()/1e6)-cacheSecretInfo.RefreshTimestamp > scc.getCacheTTL(cacheSecretInfo)
+}
+
+func (scc *SecretManagerCacheClient) judgeServeStale(cacheSecretInfo *models.CacheSecretInfo) bool {
+	if !scc.staleWhileRevalidate {
+		return false
+	}
+	if scc.maxStaleness <= 0 {
+		return true
+	}
+	return (time.Now().UnixNano()/1e6)-cacheSecretInfo.RefreshTimestamp <= scc.getCacheTTL(cacheSecretInfo)+scc.maxStaleness
+}
+
+func (scc *SecretManagerCacheClient) getCacheTTL(cacheSecretInfo *models.CacheSecretInfo) int64 {
 	ttl := scc.refreshSecretStrategy.ParseTTL(cacheSecretInfo.SecretInfo)
 	if ttl <= 0 {
-		if ttl0, ok := scc.secretTTLMap[cacheSecretInfo.SecretInfo.SecretName]; !ok {
+		if ttl0, ok := scc.getSecretTTL(cacheSecretInfo.SecretInfo.SecretName); !ok {
 			ttl = defaultTtl
 		} else {
 			ttl = ttl0
 		}
 	}
-	return (time.Now().UnixNano()/1e6)-cacheSecretInfo.RefreshTimestamp > ttl
+	return ttl
 }
 
-func (scc *SecretManagerCacheClient) getSecretValue(secretName string) (*models.SecretInfo, error) {
-	request := kms.CreateGetSecretValueRequest()
-	request.Scheme = "https"
-	request.SecretName = secretName
-	request.VersionStage = scc.stage
-	request.FetchExtendedConfig = requests.NewBoolean(true)
-	resp, err := scc.secretManagerClient.GetSecretValue(request)
+// 后台刷新过期凭据，同一凭据同时只有一个刷新任务
+func (scc *SecretManagerCacheClient) revalidate(secretName string) {
+	if _, loaded := scc.revalidating.LoadOrStore(secretName, struct{}{}); loaded {
+		return
+	}
+	if scc.acquire() != nil {
+		scc.revalidating.Delete(secretName)
+		return
+	}
+	go func() {
+		defer scc.release()
+		defer scc.revalidating.Delete(secretName)
+		if _, err := scc.refreshNow(scc.ctx, secretName, nil); err != nil {
+			logger.GetCommonLogger(utils.ModeName).Errorf("action:revalidateSecret, secretName:%s, %+v", secretName, err)
+		}
+	}()
+}
+
+func (scc *SecretManagerCacheClient) getSecretValue(ctx context.Context, secretName string) (*models.SecretInfo, error) {
+	secretInfo, err := scc.requestSecretValue(ctx, secretName, "", scc.stage)
 	if err == nil {
-		return &models.SecretInfo{
-			SecretName:        resp.SecretName,
-			VersionId:         resp.VersionId,
-			SecretValue:       resp.SecretData,
-			SecretDataType:    resp.SecretDataType,
-			CreateTime:        resp.CreateTime,
-			SecretType:        resp.SecretType,
-			AutomaticRotation: resp.AutomaticRotation,
-			ExtendedConfig:    resp.ExtendedConfig,
-			RotationInterval:  resp.RotationInterval,
-			NextRotationDate:  resp.NextRotationDate,
-		}, nil
+		return secretInfo, nil
 	} else {
 		logger.GetCommonLogger(utils.ModeName).Errorf("action:getSecretValue", err)
 		if utils.JudgeNeedRecoveryException(err) {
@@ -238,31 +518,68 @@ func (scc *SecretManagerCacheClient) getSecretValue(secretName string) (*models.
 			if secretInfo == nil {
 				return nil, err
 			}
+			if secretInfo.Recovered {
+				logger.GetCommonLogger(utils.ModeName).Warnf("secretName:%s use recovered secret value", secretName)
+			}
 			return secretInfo, nil
 		}
 	}
 	return nil, err
 }
 
-func (scc *SecretManagerCacheClient) storeAndRefresh(secretName string, secretInfo *models.SecretInfo) error {
-	_, err := scc.refreshNow(secretName, secretInfo)
+// 远程获取指定版本号或stage的凭据，versionId不为空时忽略stage
+func (scc *SecretManagerCacheClient) requestSecretValue(ctx context.Context, secretName, versionId, stage string) (*models.SecretInfo, error) {
+	request := kms.CreateGetSecretValueRequest()
+	request.Scheme = "https"
+	request.SecretName = secretName
+	if versionId != "" {
+		request.VersionId = versionId
+	} else {
+		request.VersionStage = stage
+	}
+	request.FetchExtendedConfig = requests.NewBoolean(true)
+	resp, err := scc.secretManagerClient.GetSecretValueContext(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	return &models.SecretInfo{
+		SecretName:        resp.SecretName,
+		VersionId:         resp.VersionId,
+		SecretValue:       resp.SecretData,
+		SecretDataType:    resp.SecretDataType,
+		CreateTime:        resp.CreateTime,
+		SecretType:        resp.SecretType,
+		AutomaticRotation: resp.AutomaticRotation,
+		ExtendedConfig:    resp.ExtendedConfig,
+		RotationInterval:  resp.RotationInterval,
+		NextRotationDate:  resp.NextRotationDate,
+	}, nil
+}
+
+func (scc *SecretManagerCacheClient) storeAndRefresh(ctx context.Context, secretName string, secretInfo *models.SecretInfo) error {
+	_, err := scc.refreshNow(ctx, secretName, secretInfo)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (scc *SecretManagerCacheClient) storeAndRefreshLocked(secretName string, secretInfo *models.SecretInfo) error {
-	_, err := scc.refreshNowLocked(secretName, secretInfo)
+func (scc *SecretManagerCacheClient) storeAndRefreshLocked(ctx context.Context, secretName string, secretInfo *models.SecretInfo) error {
+	_, err := scc.refreshNowLocked(ctx, secretName, secretInfo)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (scc *SecretManagerCacheClient) refresh(secretName string, secretInfo *models.SecretInfo) (err error) {
+func (scc *SecretManagerCacheClient) refresh(ctx context.Context, secretName string, secretInfo *models.SecretInfo) (err error) {
+	defer func() {
+		if err != nil {
+			scc.notifyRefreshFailed(secretName, err)
+		}
+	}()
 	if secretInfo == nil {
-		secretInfo, err = scc.getSecretValue(secretName)
+		secretInfo, err = scc.getSecretValue(ctx, secretName)
 		if err != nil {
 			return err
 		}
@@ -272,10 +589,18 @@ func (scc *SecretManagerCacheClient) refresh(secretName string, secretInfo *mode
 		return err
 	}
 	if cacheSecretInfo != nil {
+		// 缓存按stage存储，自定义hook未指定stage时使用缓存的stage
+		if cacheSecretInfo.Stage == "" {
+			cacheSecretInfo.Stage = scc.stage
+		}
+		oldCacheSecretInfo, getErr := scc.getCacheSecretInfo(secretName)
 		err = scc.cacheSecretStoreStrategy.StoreSecret(cacheSecretInfo)
 		if err != nil {
 			return err
 		}
+		if getErr == nil && oldCacheSecretInfo != nil {
+			scc.notifySecretChanged(secretName, oldCacheSecretInfo.SecretInfo, cacheSecretInfo.SecretInfo)
+		}
 	}
 	logger.GetCommonLogger(utils.ModeName).Infof("secretName:%s refresh success", secretName)
 	return nil
@@ -283,15 +608,15 @@ func (scc *SecretManagerCacheClient) refresh(secretName string, secretInfo *mode
 
 func (scc *SecretManagerCacheClient) removeRefreshTask(secretName string) {
 	if v, ok := scc.scheduledMap.Get(secretName); ok {
-		if task, okk := v.(*time.Timer); okk {
-			task.Stop()
+		if task, okk := v.(*refreshSecretTask); okk {
+			task.timer.Stop()
 			scc.scheduledMap.Remove(secretName)
 		}
 	}
 }
 
-func (scc *SecretManagerCacheClient) addRefreshTask(secretName string, runnable runnable) error {
-	cacheSecretInfo, err := scc.cacheSecretStoreStrategy.GetCacheSecretInfo(secretName)
+func (scc *SecretManagerCacheClient) addRefreshTask(secretName string) error {
+	cacheSecretInfo, err := scc.getCacheSecretInfo(secretName)
 	if err != nil {
 		return err
 	}
@@ -299,7 +624,7 @@ func (scc *SecretManagerCacheClient) addRefreshTask(secretName string, runnable
 	if executeTime <= 0 {
 		refreshTimestamp := cacheSecretInfo.RefreshTimestamp
 		ttl := defaultTtl
-		if t, ok := scc.secretTTLMap[secretName]; ok {
+		if t, ok := scc.getSecretTTL(secretName); ok {
 			ttl = t
 		}
 		executeTime = scc.refreshSecretStrategy.GetNextExecuteTime(secretName, ttl, refreshTimestamp)
@@ -311,29 +636,41 @@ func (scc *SecretManagerCacheClient) addRefreshTask(secretName string, runnable
 	if delay < 0 {
 		delay = 0
 	}
-	schedule := time.AfterFunc(time.Duration(delay)*time.Millisecond, runnable.getRunnable())
-	scc.scheduledMap.Set(secretName, schedule)
+	scc.closeMtx.RLock()
+	defer scc.closeMtx.RUnlock()
+	if scc.closed {
+		return nil
+	}
+	task := &refreshSecretTask{
+		secretName: secretName,
+		client:     scc,
+	}
+	task.timer = time.AfterFunc(time.Duration(delay)*time.Millisecond, task.getRunnable())
+	scc.scheduledMap.Set(secretName, task)
 	logger.GetCommonLogger(utils.ModeName).Infof("secretName:%s addRefreshTask success", secretName)
 	return nil
 }
 
-func (scc *SecretManagerCacheClient) refreshNow(secretName string, secretInfo *models.SecretInfo) (bool, error) {
-	lck := scc.getLock(secretName)
-	lck.Lock()
-	defer lck.Unlock()
-	return scc.refreshNowLocked(secretName, secretInfo)
+func (scc *SecretManagerCacheClient) refreshNow(ctx context.Context, secretName string, secretInfo *models.SecretInfo) (bool, error) {
+	unwatchSeq := scc.getUnwatchSeq()
+	unlock, err := scc.lockSecret(ctx, secretName)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	if scc.unwatchedSince(secretName, unwatchSeq) {
+		return false, nil
+	}
+	return scc.refreshNowLocked(ctx, secretName, secretInfo)
 }
 
-func (scc *SecretManagerCacheClient) refreshNowLocked(secretName string, secretInfo *models.SecretInfo) (bool, error) {
-	err := scc.refresh(secretName, secretInfo)
+func (scc *SecretManagerCacheClient) refreshNowLocked(ctx context.Context, secretName string, secretInfo *models.SecretInfo) (bool, error) {
+	err := scc.refresh(ctx, secretName, secretInfo)
 	if err != nil {
 		return false, err
 	}
 	scc.removeRefreshTask(secretName)
-	err = scc.addRefreshTask(secretName, &refreshSecretTask{
-		secretName: secretName,
-		client:     scc,
-	})
+	err = scc.addRefreshTask(secretName)
 	if err != nil {
 		return false, err
 	}
@@ -345,36 +682,201 @@ func (scc *SecretManagerCacheClient) judgeServerException(err error) bool {
 }
 
 func (scc *SecretManagerCacheClient) judgeSkipRefreshException(err error) bool {
-	return !scc.judgeServerException(err) && !func(err error) bool {
-		switch e := err.(type) {
-		case sdkerr.Error:
-			if utils.ErrorCodeForbiddenInDebtOverDue == e.ErrorCode() || utils.ErrorCodeForbiddenInDebt == e.ErrorCode() {
-				return true
-			}
+	return !scc.judgeServerException(err) && !utils.JudgeErrorCode(err, utils.ErrorCodeForbiddenInDebtOverDue, utils.ErrorCodeForbiddenInDebt)
+}
+
+// 以不超过maxConcurrency的并发对每个凭据执行fn，返回各凭据的错误
+func (scc *SecretManagerCacheClient) forEachSecret(secretNames []string, fn func(secretName string) error) map[string]error {
+	concurrency := scc.maxConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultMaxConcurrency
+	}
+	var wg sync.WaitGroup
+	var mtx sync.Mutex
+	errs := make(map[string]error)
+	visited := make(map[string]struct{}, len(secretNames))
+	sem := make(chan struct{}, concurrency)
+	for _, secretName := range secretNames {
+		if _, ok := visited[secretName]; ok {
+			continue
 		}
-		return false
-	}(err)
+		visited[secretName] = struct{}{}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(secretName string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := fn(secretName); err != nil {
+				mtx.Lock()
+				errs[secretName] = err
+				mtx.Unlock()
+			}
+		}(secretName)
+	}
+	wg.Wait()
+	return errs
 }
 
-func (scc *SecretManagerCacheClient) getLock(key string) *sync.Mutex {
-	scc.secretNameMtx.Lock()
-	defer scc.secretNameMtx.Unlock()
-	mtx, ok := scc.secretNameMtxMap[key]
+// 获取凭据锁，等待期间ctx结束时放弃并返回ctx的错误，成功时返回释放锁的函数
+func (scc *SecretManagerCacheClient) lockSecret(ctx context.Context, key string) (func(), error) {
+	lck := scc.refLock(key)
+	select {
+	case lck.ch <- struct{}{}:
+		return func() {
+			notifies := scc.takePendingNotifies(lck)
+			<-lck.ch
+			scc.unrefLock(key, lck)
+			for _, notify := range notifies {
+				notify()
+			}
+		}, nil
+	case <-ctx.Done():
+		scc.unrefLock(key, lck)
+		return nil, ctx.Err()
+	}
+}
+
+func (scc *SecretManagerCacheClient) refLock(key string) *secretLock {
+	scc.secretLockMtx.Lock()
+	defer scc.secretLockMtx.Unlock()
+	if scc.secretLockMap == nil {
+		scc.secretLockMap = make(map[string]*secretLock)
+	}
+	lck, ok := scc.secretLockMap[key]
+	if !ok {
+		lck = &secretLock{ch: make(chan struct{}, 1)}
+		scc.secretLockMap[key] = lck
+	}
+	lck.refs++
+	return lck
+}
+
+func (scc *SecretManagerCacheClient) unrefLock(key string, lck *secretLock) {
+	scc.secretLockMtx.Lock()
+	defer scc.secretLockMtx.Unlock()
+	lck.refs--
+	if lck.refs == 0 {
+		delete(scc.secretLockMap, key)
+	}
+}
+
+// 在凭据锁释放后执行监听器回调，避免回调中获取同一凭据时等待调用方持有的锁，调用方需持有该凭据的锁
+func (scc *SecretManagerCacheClient) deferNotify(secretName string, notify func()) {
+	scc.secretLockMtx.Lock()
+	lck, ok := scc.secretLockMap[secretName]
 	if ok {
-		return mtx
+		lck.pendingNotifies = append(lck.pendingNotifies, notify)
+	}
+	scc.secretLockMtx.Unlock()
+	if !ok {
+		go notify()
 	}
-	scc.secretNameMtxMap[key] = &sync.Mutex{}
-	return scc.secretNameMtxMap[key]
+}
+
+func (scc *SecretManagerCacheClient) takePendingNotifies(lck *secretLock) []func() {
+	scc.secretLockMtx.Lock()
+	defer scc.secretLockMtx.Unlock()
+	notifies := lck.pendingNotifies
+	lck.pendingNotifies = nil
+	return notifies
+}
+
+// 标记凭据已取消监听，调用方需持有该凭据的锁
+func (scc *SecretManagerCacheClient) markUnwatched(secretName string) {
+	scc.secretLockMtx.Lock()
+	defer scc.secretLockMtx.Unlock()
+	scc.unwatchSeq++
+	if lck, ok := scc.secretLockMap[secretName]; ok {
+		lck.unwatchSeq = scc.unwatchSeq
+	}
+}
+
+func (scc *SecretManagerCacheClient) getUnwatchSeq() int64 {
+	scc.secretLockMtx.Lock()
+	defer scc.secretLockMtx.Unlock()
+	return scc.unwatchSeq
+}
+
+// 判断获取序号unwatchSeq后凭据是否被取消监听，调用方需持有该凭据的锁
+func (scc *SecretManagerCacheClient) unwatchedSince(secretName string, unwatchSeq int64) bool {
+	scc.secretLockMtx.Lock()
+	defer scc.secretLockMtx.Unlock()
+	lck, ok := scc.secretLockMap[secretName]
+	return ok && lck.unwatchSeq > unwatchSeq
+}
+
+// 获取缓存stage的凭据缓存，缓存策略未实现StageAwareSecretCacheStoreStrategy时按凭据名称获取
+func (scc *SecretManagerCacheClient) getCacheSecretInfo(secretName string) (*models.CacheSecretInfo, error) {
+	if store, ok := scc.cacheSecretStoreStrategy.(cache.StageAwareSecretCacheStoreStrategy); ok {
+		return store.GetCacheSecretInfoByStage(secretName, scc.stage)
+	}
+	return scc.cacheSecretStoreStrategy.GetCacheSecretInfo(secretName)
+}
+
+// 移除凭据缓存，缓存策略未实现RemovableSecretCacheStoreStrategy时以已过期的缓存覆盖，下次获取时从KMS重新拉取
+func (scc *SecretManagerCacheClient) removeCacheSecret(secretName string) error {
+	if store, ok := scc.cacheSecretStoreStrategy.(cache.RemovableSecretCacheStoreStrategy); ok {
+		return store.RemoveSecret(secretName)
+	}
+	cacheSecretInfo, err := scc.getCacheSecretInfo(secretName)
+	if err != nil || cacheSecretInfo == nil {
+		return nil
+	}
+	expired := cacheSecretInfo.Clone()
+	expired.RefreshTimestamp = 0
+	return scc.cacheSecretStoreStrategy.StoreSecret(expired)
+}
+
+func (scc *SecretManagerCacheClient) getSecretTTL(secretName string) (int64, bool) {
+	scc.secretTTLMtx.RLock()
+	defer scc.secretTTLMtx.RUnlock()
+	ttl, ok := scc.secretTTLMap[secretName]
+	return ttl, ok
+}
+
+func (scc *SecretManagerCacheClient) setSecretTTL(secretName string, ttl int64) {
+	scc.secretTTLMtx.Lock()
+	defer scc.secretTTLMtx.Unlock()
+	scc.secretTTLMap[secretName] = ttl
+}
+
+func (scc *SecretManagerCacheClient) deleteSecretTTL(secretName string) {
+	scc.secretTTLMtx.Lock()
+	defer scc.secretTTLMtx.Unlock()
+	delete(scc.secretTTLMap, secretName)
+}
+
+func (scc *SecretManagerCacheClient) getSecretNames() []string {
+	scc.secretTTLMtx.RLock()
+	defer scc.secretTTLMtx.RUnlock()
+	secretNames := make([]string, 0, len(scc.secretTTLMap))
+	for secretName := range scc.secretTTLMap {
+		secretNames = append(secretNames, secretName)
+	}
+	return secretNames
 }
 
 func (rst *refreshSecretTask) getRunnable() func() {
 	return func() {
-		err := rst.client.refresh(rst.secretName, nil)
+		if rst.client.acquire() != nil {
+			return
+		}
+		defer rst.client.release()
+		unlock, err := rst.client.lockSecret(rst.client.ctx, rst.secretName)
+		if err != nil {
+			return
+		}
+		defer unlock()
+		// 任务已被取消或替换
+		if task, ok := rst.client.scheduledMap.Get(rst.secretName); !ok || task != rst {
+			return
+		}
+		err = rst.client.refresh(rst.client.ctx, rst.secretName, nil)
 		if err != nil {
 			logger.GetCommonLogger(utils.ModeName).Errorf("action:refreshSecretTask", err)
 		}
 		rst.client.removeRefreshTask(rst.secretName)
-		err = rst.client.addRefreshTask(rst.secretName, rst)
+		err = rst.client.addRefreshTask(rst.secretName)
 		if err != nil {
 			logger.GetCommonLogger(utils.ModeName).Errorf("action:addRefreshTask", err)
 		}
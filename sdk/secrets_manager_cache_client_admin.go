@@ -0,0 +1,107 @@
+package sdk
+
+import (
+	"context"
+
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/logger"
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/service"
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/utils"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/kms"
+)
+
+// PutSecretValue 写入凭据新版本，成功后刷新本地缓存
+func (scc *SecretManagerCacheClient) PutSecretValue(ctx context.Context, req *kms.PutSecretValueRequest) (*kms.PutSecretValueResponse, error) {
+	adminClient, err := scc.getAdminClient(req.SecretName)
+	if err != nil {
+		return nil, err
+	}
+	if err := scc.acquire(); err != nil {
+		return nil, err
+	}
+	defer scc.release()
+	resp, err := adminClient.PutSecretValue(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	scc.invalidate(ctx, req.SecretName)
+	return resp, nil
+}
+
+// UpdateSecretVersionStage 更新凭据版本状态，成功后刷新本地缓存
+func (scc *SecretManagerCacheClient) UpdateSecretVersionStage(ctx context.Context, req *kms.UpdateSecretVersionStageRequest) (*kms.UpdateSecretVersionStageResponse, error) {
+	adminClient, err := scc.getAdminClient(req.SecretName)
+	if err != nil {
+		return nil, err
+	}
+	if err := scc.acquire(); err != nil {
+		return nil, err
+	}
+	defer scc.release()
+	resp, err := adminClient.UpdateSecretVersionStage(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	scc.invalidate(ctx, req.SecretName)
+	return resp, nil
+}
+
+// RotateSecret 手动轮转凭据，成功后刷新本地缓存
+func (scc *SecretManagerCacheClient) RotateSecret(ctx context.Context, req *kms.RotateSecretRequest) (*kms.RotateSecretResponse, error) {
+	adminClient, err := scc.getAdminClient(req.SecretName)
+	if err != nil {
+		return nil, err
+	}
+	if err := scc.acquire(); err != nil {
+		return nil, err
+	}
+	defer scc.release()
+	resp, err := adminClient.RotateSecret(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	scc.invalidate(ctx, req.SecretName)
+	return resp, nil
+}
+
+func (scc *SecretManagerCacheClient) getAdminClient(secretName string) (service.SecretManagerAdminClient, error) {
+	adminClient, ok := scc.secretManagerClient.(service.SecretManagerAdminClient)
+	if !ok {
+		return nil, &utils.SecretError{SecretName: secretName, Message: "the secret manager client does not support write operations", Err: utils.ErrOperationNotSupported}
+	}
+	return adminClient, nil
+}
+
+// 在凭据锁内立即刷新已缓存的凭据，保留旧缓存以触发凭据变更通知，
+// 等待凭据锁或刷新失败时删除缓存，下次获取时从KMS重新拉取，写操作已成功因此只记录错误，
+// 刷新时直接请求KMS，不使用cacheHook恢复写操作之前的凭据
+func (scc *SecretManagerCacheClient) invalidate(ctx context.Context, secretName string) {
+	// 写操作可能改变各stage指向的版本，版本号对应的内容不变因此保留
+	scc.removeVersionCache(secretName, false)
+	unlock, err := scc.lockSecret(ctx, secretName)
+	if err != nil {
+		scc.removeStaleSecret(secretName, err)
+		return
+	}
+	defer unlock()
+	if _, err := scc.getCacheSecretInfo(secretName); err != nil {
+		return
+	}
+	secretInfo, err := scc.requestSecretValue(ctx, secretName, "", scc.stage)
+	if err != nil {
+		scc.notifyRefreshFailed(secretName, err)
+		scc.removeStaleSecret(secretName, err)
+		return
+	}
+	if _, err = scc.refreshNowLocked(ctx, secretName, secretInfo); err != nil {
+		scc.removeStaleSecret(secretName, err)
+	}
+}
+
+// 删除写操作后无法刷新的缓存，避免继续返回旧版本
+func (scc *SecretManagerCacheClient) removeStaleSecret(secretName string, cause error) {
+	logger.GetCommonLogger(utils.ModeName).Errorf("action:invalidate, secretName:%s, %+v", secretName, cause)
+	if err := scc.removeCacheSecret(secretName); err != nil {
+		logger.GetCommonLogger(utils.ModeName).Errorf("action:invalidate, secretName:%s, %+v", secretName, err)
+	}
+}
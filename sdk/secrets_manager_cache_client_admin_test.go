@@ -0,0 +1,163 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/cache"
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/service"
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/utils"
+
+	sdkerr "github.com/aliyun/alibaba-cloud-sdk-go/sdk/errors"
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/kms"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeAdminSecretManagerClient 只实现PutSecretValue，其余写操作未实现
+type fakeAdminSecretManagerClient struct {
+	*fakeSecretManagerClient
+	service.SecretManagerAdminClient
+}
+
+func (f *fakeAdminSecretManagerClient) PutSecretValue(ctx context.Context, req *kms.PutSecretValueRequest) (*kms.PutSecretValueResponse, error) {
+	f.putSecret(req.SecretName, req.VersionId, req.SecretData)
+	resp := kms.CreatePutSecretValueResponse()
+	resp.SecretName = req.SecretName
+	resp.VersionId = req.VersionId
+	return resp, nil
+}
+
+func TestSecretCacheClient_PutSecretValue(t *testing.T) {
+	fake := &fakeAdminSecretManagerClient{fakeSecretManagerClient: newFakeSecretManagerClient()}
+	fake.putSecret("secret", "v1", "value1")
+	listener := &recordingSecretChangeListener{}
+	client, err := NewSecretCacheClientBuilder(fake).WithSecretChangeListener(listener).Build()
+	assert.Nil(t, err)
+	defer client.Close()
+
+	secretInfo, err := client.GetSecretInfo("secret")
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", secretInfo.VersionId)
+
+	req := kms.CreatePutSecretValueRequest()
+	req.SecretName = "secret"
+	req.VersionId = "v2"
+	req.SecretData = "value2"
+	resp, err := client.PutSecretValue(context.Background(), req)
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", resp.VersionId)
+
+	// 写入成功后立即刷新缓存并通知凭据变更
+	calls := fake.getCalls()
+	secretInfo, err = client.GetSecretInfo("secret")
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", secretInfo.VersionId)
+	assert.Equal(t, "value2", secretInfo.SecretValue)
+	assert.Equal(t, calls, fake.getCalls())
+	listener.mtx.Lock()
+	defer listener.mtx.Unlock()
+	if assert.Equal(t, 1, len(listener.changed)) {
+		assert.Equal(t, "v1", listener.changed[0][0].VersionId)
+		assert.Equal(t, "v2", listener.changed[0][1].VersionId)
+	}
+}
+
+func TestSecretCacheClient_PutSecretValueRefreshFailed(t *testing.T) {
+	fake := &fakeAdminSecretManagerClient{fakeSecretManagerClient: newFakeSecretManagerClient()}
+	fake.putSecret("secret", "v1", "value1")
+	client, err := NewSecretCacheClientBuilder(fake).Build()
+	assert.Nil(t, err)
+	defer client.Close()
+	_, err = client.GetSecretInfo("secret")
+	assert.Nil(t, err)
+
+	// 写入后刷新失败时删除缓存，不再返回旧版本
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := kms.CreatePutSecretValueRequest()
+	req.SecretName = "secret"
+	req.VersionId = "v2"
+	req.SecretData = "value2"
+	_, err = client.PutSecretValue(ctx, req)
+	assert.Nil(t, err)
+	_, err = client.getCacheSecretInfo("secret")
+	assert.NotNil(t, err)
+	secretInfo, err := client.GetSecretInfo("secret")
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", secretInfo.VersionId)
+}
+
+func TestSecretCacheClient_PutSecretValueNoRecovery(t *testing.T) {
+	cacheSecretPath, err := ioutil.TempDir("", "secret_cache")
+	assert.Nil(t, err)
+	defer os.RemoveAll(cacheSecretPath)
+	fake := &fakeAdminSecretManagerClient{fakeSecretManagerClient: newFakeSecretManagerClient()}
+	fake.putSecret("secret", "v1", "value1")
+	store := cache.NewFileCacheSecretStoreStrategy(cacheSecretPath, true, "salt")
+	client, err := NewSecretCacheClientBuilder(fake).WithCacheSecretStrategy(store).
+		WithSecretCacheHook(cache.NewFileRecoverySecretCacheHook(utils.StageAcsCurrent, store, 0)).Build()
+	assert.Nil(t, err)
+	defer client.Close()
+	_, err = client.GetSecretInfo("secret")
+	assert.Nil(t, err)
+
+	// 写入成功后KMS不可用，不使用文件缓存恢复写入前的凭据，直接删除缓存
+	fake.setErr(sdkerr.NewServerError(503, `{"Code":"ServiceUnavailableTemporary"}`, ""))
+	req := kms.CreatePutSecretValueRequest()
+	req.SecretName = "secret"
+	req.VersionId = "v2"
+	req.SecretData = "value2"
+	_, err = client.PutSecretValue(context.Background(), req)
+	assert.Nil(t, err)
+	_, err = client.getCacheSecretInfo("secret")
+	assert.NotNil(t, err)
+
+	fake.setErr(nil)
+	secretInfo, err := client.GetSecretInfo("secret")
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", secretInfo.VersionId)
+	assert.False(t, secretInfo.Recovered)
+}
+
+func TestSecretCacheClient_PutSecretValueLockTimeout(t *testing.T) {
+	fake := &fakeAdminSecretManagerClient{fakeSecretManagerClient: newFakeSecretManagerClient()}
+	fake.putSecret("secret", "v1", "value1")
+	client, err := NewSecretCacheClientBuilder(fake).Build()
+	assert.Nil(t, err)
+	defer client.Close()
+	_, err = client.GetSecretInfo("secret")
+	assert.Nil(t, err)
+
+	// 等待凭据锁超时后不再刷新，直接删除缓存
+	unlock, err := client.lockSecret(context.Background(), "secret")
+	assert.Nil(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req := kms.CreatePutSecretValueRequest()
+	req.SecretName = "secret"
+	req.VersionId = "v2"
+	req.SecretData = "value2"
+	_, err = client.PutSecretValue(ctx, req)
+	assert.Nil(t, err)
+	_, err = client.getCacheSecretInfo("secret")
+	assert.NotNil(t, err)
+	unlock()
+	secretInfo, err := client.GetSecretInfo("secret")
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", secretInfo.VersionId)
+}
+
+func TestSecretCacheClient_WriteNotSupported(t *testing.T) {
+	fake := newFakeSecretManagerClient()
+	client := newFakeCacheClient(t, fake)
+	defer client.Close()
+
+	req := kms.CreateRotateSecretRequest()
+	req.SecretName = "secret"
+	_, err := client.RotateSecret(context.Background(), req)
+	assert.True(t, errors.Is(err, utils.ErrOperationNotSupported))
+}
@@ -31,7 +31,7 @@ func NewSecretCacheClientBuilder(client service.SecretManagerClient) *SecretCach
 // 设定指定凭据名称的凭据TTL
 func (scb *SecretCacheClientBuilder) WithSecretTTL(secretName string, ttl int64) *SecretCacheClientBuilder {
 	scb.buildSecretCacheClient()
-	scb.secretCacheClient.secretTTLMap[secretName] = ttl
+	scb.secretCacheClient.setSecretTTL(secretName, ttl)
 	return scb
 }
 
@@ -70,6 +70,42 @@ func (scb *SecretCacheClientBuilder) WithSecretCacheHook(hook cache.SecretCacheH
 	return scb
 }
 
+// 开启缓存过期后先返回旧值并在后台刷新，超过TTL+maxStaleness(单位MS)后改为同步获取，maxStaleness小于等于0表示不限制
+func (scb *SecretCacheClientBuilder) WithStaleWhileRevalidate(maxStaleness int64) *SecretCacheClientBuilder {
+	scb.buildSecretCacheClient()
+	scb.secretCacheClient.staleWhileRevalidate = true
+	scb.secretCacheClient.maxStaleness = maxStaleness
+	return scb
+}
+
+// 设定批量获取及启动时预加载凭据的最大并发数
+func (scb *SecretCacheClientBuilder) WithMaxConcurrency(maxConcurrency int) *SecretCacheClientBuilder {
+	scb.buildSecretCacheClient()
+	scb.secretCacheClient.maxConcurrency = maxConcurrency
+	return scb
+}
+
+// 设定按版本号或非缓存stage获取的凭据缓存的最大数量，超过时淘汰最久未访问的缓存，小于等于0表示不限制
+func (scb *SecretCacheClientBuilder) WithMaxVersionCacheSize(maxVersionCacheSize int) *SecretCacheClientBuilder {
+	scb.buildSecretCacheClient()
+	scb.secretCacheClient.versionCache.capacity = maxVersionCacheSize
+	return scb
+}
+
+// 指定读取secret_names的配置文件，默认使用SecretManagerClient的配置文件或secretsmanager.properties
+func (scb *SecretCacheClientBuilder) WithCustomConfigFile(customConfigFile string) *SecretCacheClientBuilder {
+	scb.buildSecretCacheClient()
+	scb.secretCacheClient.customConfigFile = customConfigFile
+	return scb
+}
+
+// 添加凭据变更监听器
+func (scb *SecretCacheClientBuilder) WithSecretChangeListener(listener SecretChangeListener) *SecretCacheClientBuilder {
+	scb.buildSecretCacheClient()
+	scb.secretCacheClient.AddSecretChangeListener(listener)
+	return scb
+}
+
 // 指定输出日志
 func (scb *SecretCacheClientBuilder) WithLogger(l logger.Wrapper) *SecretCacheClientBuilder {
 	err := logger.RegisterLogger(utils.ModeName, l)
@@ -1,17 +1,28 @@
 package sdk
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/cache"
 	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/logger"
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/models"
 	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/service"
 	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/utils"
 
+	sdkerr "github.com/aliyun/alibaba-cloud-sdk-go/sdk/errors"
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/kms"
 	cmap "github.com/orcaman/concurrent-map"
 	"github.com/stretchr/testify/assert"
 )
@@ -21,6 +32,135 @@ var (
 	accessKeySecret = os.Getenv("credentials_access_secret")
 )
 
+type fakeSecretManagerClient struct {
+	mtx sync.Mutex
+	// key为凭据名称及版本号
+	versions map[string]*kms.GetSecretValueResponse
+	// key为凭据名称及stage，value为版本号
+	stages map[string]string
+	err    error
+	calls  int
+	// 非空时请求阻塞直到关闭该channel或ctx结束
+	block chan struct{}
+	// 每次请求的耗时及最大并发请求数
+	delay      time.Duration
+	running    int
+	maxRunning int
+}
+
+// 未指定KeyProvider的文件缓存使用环境变量中的主密钥
+func TestMain(m *testing.M) {
+	masterKey := make([]byte, utils.RandomKeyLength)
+	if _, err := rand.Read(masterKey); err != nil {
+		panic(err)
+	}
+	os.Setenv(utils.EnvCacheMasterKeyKey, base64.StdEncoding.EncodeToString(masterKey))
+	os.Exit(m.Run())
+}
+
+func newFakeSecretManagerClient() *fakeSecretManagerClient {
+	return &fakeSecretManagerClient{
+		versions: make(map[string]*kms.GetSecretValueResponse),
+		stages:   make(map[string]string),
+	}
+}
+
+func (f *fakeSecretManagerClient) putSecret(secretName, versionId, secretData string) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	resp := kms.CreateGetSecretValueResponse()
+	resp.SecretName = secretName
+	resp.VersionId = versionId
+	resp.SecretData = secretData
+	resp.SecretDataType = utils.TextDataType
+	f.versions[secretName+"/"+versionId] = resp
+	// 写入新版本时原ACSCurrent版本变为ACSPrevious
+	if currentVersionId, ok := f.stages[secretName+"/"+utils.StageAcsCurrent]; ok && currentVersionId != versionId {
+		f.stages[secretName+"/ACSPrevious"] = currentVersionId
+	}
+	f.stages[secretName+"/"+utils.StageAcsCurrent] = versionId
+}
+
+func (f *fakeSecretManagerClient) setErr(err error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.err = err
+}
+
+func (f *fakeSecretManagerClient) setBlock(block chan struct{}) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.block = block
+}
+
+func (f *fakeSecretManagerClient) getCalls() int {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return f.calls
+}
+
+func (f *fakeSecretManagerClient) Init() error {
+	return nil
+}
+
+func (f *fakeSecretManagerClient) GetSecretValue(req *kms.GetSecretValueRequest) (*kms.GetSecretValueResponse, error) {
+	return f.GetSecretValueContext(context.Background(), req)
+}
+
+func (f *fakeSecretManagerClient) GetSecretValueContext(ctx context.Context, req *kms.GetSecretValueRequest) (*kms.GetSecretValueResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mtx.Lock()
+	block := f.block
+	f.mtx.Unlock()
+	if block != nil {
+		select {
+		case <-block:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	f.mtx.Lock()
+	f.running++
+	if f.running > f.maxRunning {
+		f.maxRunning = f.running
+	}
+	delay := f.delay
+	f.mtx.Unlock()
+	time.Sleep(delay)
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.running--
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	versionId := req.VersionId
+	if versionId == "" {
+		stage := req.VersionStage
+		if stage == "" {
+			stage = utils.StageAcsCurrent
+		}
+		versionId = f.stages[req.SecretName+"/"+stage]
+	}
+	resp, ok := f.versions[req.SecretName+"/"+versionId]
+	if !ok {
+		return nil, sdkerr.NewServerError(404, `{"Code":"Forbidden.ResourceNotFound","Message":"secret not found"}`, "")
+	}
+	return resp, nil
+}
+
+func (f *fakeSecretManagerClient) Close() error {
+	return nil
+}
+
+func newFakeCacheClient(t *testing.T, fake *fakeSecretManagerClient) *SecretManagerCacheClient {
+	client, err := NewSecretCacheClientBuilder(fake).Build()
+	assert.Nil(t, err)
+	return client
+}
+
 func TestNewSecretCacheClient(t *testing.T) {
 	client := NewSecretCacheClient()
 	assert.Equal(t, defaultJsonTtlPropertyName, client.jsonTTLPropertyName)
@@ -50,7 +190,6 @@ func TestSecretCacheClient_GetSecretInfo(t *testing.T) {
 		cacheHook:                cache.NewDefaultSecretCacheHook(utils.StageAcsCurrent),
 		secretTTLMap:             make(map[string]int64),
 		scheduledMap:             cmap.New(),
-		secretNameMtxMap:         make(map[string]*sync.Mutex),
 	}
 
 	err = client.Init()
@@ -80,7 +219,6 @@ func TestSecretCacheClient_RefreshNow(t *testing.T) {
 		cacheHook:                cache.NewDefaultSecretCacheHook(utils.StageAcsCurrent),
 		secretTTLMap:             make(map[string]int64),
 		scheduledMap:             cmap.New(),
-		secretNameMtxMap:         make(map[string]*sync.Mutex),
 	}
 
 	client.secretTTLMap[secretName] = 10 * 1000
@@ -112,3 +250,763 @@ func TestSecretCacheClient_RefreshNow(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func TestSecretCacheClient_GetSecretInfoContext(t *testing.T) {
+	fake := newFakeSecretManagerClient()
+	fake.putSecret("cache_client", "v1", "value")
+	client := newFakeCacheClient(t, fake)
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := client.GetSecretInfoContext(ctx, "cache_client")
+	assert.Equal(t, context.Canceled, err)
+
+	value, err := client.GetStringValueContext(context.Background(), "cache_client")
+	assert.Nil(t, err)
+	assert.Equal(t, "value", value)
+
+	// 命中缓存时不再远程获取凭据
+	value, err = client.GetStringValueContext(ctx, "cache_client")
+	assert.Nil(t, err)
+	assert.Equal(t, "value", value)
+	assert.Equal(t, 1, fake.getCalls())
+}
+
+type recordingSecretChangeListener struct {
+	mtx      sync.Mutex
+	changed  [][2]*models.SecretInfo
+	failures []string
+}
+
+func (l *recordingSecretChangeListener) OnSecretChanged(oldSecretInfo, newSecretInfo *models.SecretInfo) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.changed = append(l.changed, [2]*models.SecretInfo{oldSecretInfo, newSecretInfo})
+}
+
+func (l *recordingSecretChangeListener) OnRefreshFailed(secretName string, err error) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.failures = append(l.failures, secretName)
+}
+
+func TestSecretCacheClient_SecretChangeListener(t *testing.T) {
+	fake := newFakeSecretManagerClient()
+	fake.putSecret("cache_client", "v1", "value1")
+	listener := &recordingSecretChangeListener{}
+	client, err := NewSecretCacheClientBuilder(fake).WithSecretChangeListener(listener).Build()
+	assert.Nil(t, err)
+	defer client.Close()
+
+	_, err = client.GetSecretInfo("cache_client")
+	assert.Nil(t, err)
+
+	// 版本未变化时不触发回调
+	ok, err := client.RefreshNow("cache_client")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 0, len(listener.changed))
+
+	fake.putSecret("cache_client", "v2", "value2")
+	ok, err = client.RefreshNow("cache_client")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 1, len(listener.changed))
+	assert.Equal(t, "v1", listener.changed[0][0].VersionId)
+	assert.Equal(t, "v2", listener.changed[0][1].VersionId)
+
+	client.RemoveSecretChangeListener(listener)
+	fake.putSecret("cache_client", "v3", "value3")
+	_, err = client.RefreshNow("cache_client")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(listener.changed))
+
+	client.AddSecretChangeListener(listener)
+	fake.setErr(sdkerr.NewServerError(400, `{"Code":"Forbidden.NoPermission"}`, ""))
+	ok, err = client.RefreshNow("cache_client")
+	assert.NotNil(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, []string{"cache_client"}, listener.failures)
+}
+
+// funcSecretChangeListener 值接收者且包含函数及slice字段，动态类型不可比较
+type funcSecretChangeListener struct {
+	onChanged func(oldSecretInfo, newSecretInfo *models.SecretInfo)
+	tags      []string
+}
+
+func (l funcSecretChangeListener) OnSecretChanged(oldSecretInfo, newSecretInfo *models.SecretInfo) {
+	l.onChanged(oldSecretInfo, newSecretInfo)
+}
+
+func (l funcSecretChangeListener) OnRefreshFailed(secretName string, err error) {
+}
+
+func TestSecretCacheClient_RemoveNonComparableListener(t *testing.T) {
+	fake := newFakeSecretManagerClient()
+	fake.putSecret("cache_client", "v1", "value1")
+	client := newFakeCacheClient(t, fake)
+	defer client.Close()
+
+	var changed int32
+	listener := funcSecretChangeListener{
+		onChanged: func(oldSecretInfo, newSecretInfo *models.SecretInfo) {
+			atomic.AddInt32(&changed, 1)
+		},
+		tags: []string{"adapter"},
+	}
+	recording := &recordingSecretChangeListener{}
+	client.AddSecretChangeListener(recording)
+	id := client.AddSecretChangeListener(listener)
+	assert.NotEqual(t, int64(0), id)
+
+	_, err := client.GetSecretInfo("cache_client")
+	assert.Nil(t, err)
+	fake.putSecret("cache_client", "v2", "value2")
+	_, err = client.RefreshNow("cache_client")
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&changed))
+
+	// 不可比较的监听器按值移除时不应panic，也不影响其他监听器
+	assert.NotPanics(t, func() {
+		client.RemoveSecretChangeListener(listener)
+	})
+	assert.Equal(t, 2, len(client.getListeners()))
+
+	client.RemoveSecretChangeListenerById(id)
+	assert.Equal(t, 1, len(client.getListeners()))
+	fake.putSecret("cache_client", "v3", "value3")
+	_, err = client.RefreshNow("cache_client")
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&changed))
+	assert.Equal(t, 2, len(recording.changed))
+}
+
+// reentrantSecretChangeListener 在回调中再次调用Client获取或刷新同一凭据
+type reentrantSecretChangeListener struct {
+	client        *SecretManagerCacheClient
+	changedOnce   sync.Once
+	failedOnce    sync.Once
+	refreshResult chan error
+	getResult     chan error
+}
+
+func (l *reentrantSecretChangeListener) OnSecretChanged(oldSecretInfo, newSecretInfo *models.SecretInfo) {
+	l.changedOnce.Do(func() {
+		_, err := l.client.RefreshNow(newSecretInfo.SecretName)
+		l.refreshResult <- err
+	})
+}
+
+func (l *reentrantSecretChangeListener) OnRefreshFailed(secretName string, err error) {
+	l.failedOnce.Do(func() {
+		_, err := l.client.GetSecretInfo(secretName)
+		l.getResult <- err
+	})
+}
+
+func TestSecretCacheClient_ReentrantListener(t *testing.T) {
+	fake := newFakeSecretManagerClient()
+	fake.putSecret("cache_client", "v1", "value1")
+	listener := &reentrantSecretChangeListener{refreshResult: make(chan error, 1), getResult: make(chan error, 1)}
+	client, err := NewSecretCacheClientBuilder(fake).WithSecretChangeListener(listener).Build()
+	assert.Nil(t, err)
+	listener.client = client
+	defer client.Close()
+
+	_, err = client.GetSecretInfo("cache_client")
+	assert.Nil(t, err)
+	fake.putSecret("cache_client", "v2", "value2")
+	ok, err := client.RefreshNow("cache_client")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	select {
+	case err = <-listener.refreshResult:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("RefreshNow in OnSecretChanged blocked on the secret lock")
+	}
+
+	// 定时刷新失败时凭据已过期，回调中获取凭据需要再次获取凭据锁
+	assert.Nil(t, client.Watch("cache_client", 50))
+	fake.setErr(sdkerr.NewServerError(400, `{"Code":"Forbidden.NoPermission"}`, ""))
+	select {
+	case err = <-listener.getResult:
+		assert.NotNil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("GetSecretInfo in OnRefreshFailed blocked on the secret lock")
+	}
+}
+
+func TestSecretCacheClient_WatchAndUnwatch(t *testing.T) {
+	fake := newFakeSecretManagerClient()
+	fake.putSecret("cache_client", "v1", "value1")
+	client := newFakeCacheClient(t, fake)
+	defer client.Close()
+
+	err := client.Watch("cache_client", 10*1000)
+	assert.Nil(t, err)
+	assert.True(t, client.scheduledMap.Has("cache_client"))
+	ttl, ok := client.getSecretTTL("cache_client")
+	assert.True(t, ok)
+	assert.Equal(t, int64(10*1000), ttl)
+	_, err = client.getCacheSecretInfo("cache_client")
+	assert.Nil(t, err)
+
+	err = client.Unwatch("cache_client")
+	assert.Nil(t, err)
+	assert.False(t, client.scheduledMap.Has("cache_client"))
+	_, ok = client.getSecretTTL("cache_client")
+	assert.False(t, ok)
+	_, err = client.getCacheSecretInfo("cache_client")
+	assert.NotNil(t, err)
+	_, ok = client.secretLockMap["cache_client"]
+	assert.False(t, ok)
+
+	err = client.Watch("not_exist", 10*1000)
+	assert.NotNil(t, err)
+	assert.False(t, client.scheduledMap.Has("not_exist"))
+	_, ok = client.getSecretTTL("not_exist")
+	assert.False(t, ok)
+}
+
+// legacySecretCacheStoreStrategy 只实现SecretCacheStoreStrategy的自定义缓存策略
+type legacySecretCacheStoreStrategy struct {
+	cacheSecretInfoMap sync.Map
+}
+
+func (ls *legacySecretCacheStoreStrategy) Init() error {
+	return nil
+}
+
+func (ls *legacySecretCacheStoreStrategy) StoreSecret(cacheSecretInfo *models.CacheSecretInfo) error {
+	ls.cacheSecretInfoMap.Store(cacheSecretInfo.SecretInfo.SecretName, cacheSecretInfo)
+	return nil
+}
+
+func (ls *legacySecretCacheStoreStrategy) GetCacheSecretInfo(secretName string) (*models.CacheSecretInfo, error) {
+	if cacheSecretInfo, ok := ls.cacheSecretInfoMap.Load(secretName); ok {
+		return cacheSecretInfo.(*models.CacheSecretInfo), nil
+	}
+	return nil, fmt.Errorf("secret [%s] not found", secretName)
+}
+
+func (ls *legacySecretCacheStoreStrategy) Close() error {
+	return nil
+}
+
+func TestSecretCacheClient_LegacySecretCacheStoreStrategy(t *testing.T) {
+	fake := newFakeSecretManagerClient()
+	fake.putSecret("cache_client", "v1", "value1")
+	store := &legacySecretCacheStoreStrategy{}
+	client, err := NewSecretCacheClientBuilder(fake).WithCacheSecretStrategy(store).Build()
+	assert.Nil(t, err)
+	defer client.Close()
+
+	err = client.Watch("cache_client", 10*1000)
+	assert.Nil(t, err)
+	secretInfo, err := client.GetSecretInfo("cache_client")
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", secretInfo.VersionId)
+	assert.Equal(t, 1, fake.getCalls())
+
+	// 不支持移除的缓存策略以已过期的缓存覆盖，再次获取时重新拉取
+	fake.putSecret("cache_client", "v2", "value2")
+	err = client.Unwatch("cache_client")
+	assert.Nil(t, err)
+	cacheSecretInfo, err := store.GetCacheSecretInfo("cache_client")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), cacheSecretInfo.RefreshTimestamp)
+	secretInfo, err = client.GetSecretInfo("cache_client")
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", secretInfo.VersionId)
+	assert.Equal(t, 2, fake.getCalls())
+}
+
+func TestSecretCacheClient_WatchFailedKeepsDefaultTTL(t *testing.T) {
+	fake := newFakeSecretManagerClient()
+	fake.putSecret("cache_client", "v1", "value1")
+	client := newFakeCacheClient(t, fake)
+	defer client.Close()
+
+	fake.setErr(sdkerr.NewServerError(400, `{"Code":"Forbidden.NoPermission"}`, ""))
+	err := client.Watch("cache_client", 10*1000)
+	assert.NotNil(t, err)
+	_, ok := client.getSecretTTL("cache_client")
+	assert.False(t, ok)
+
+	// 监听失败后懒加载的凭据使用默认ttl
+	fake.setErr(nil)
+	_, err = client.GetSecretInfo("cache_client")
+	assert.Nil(t, err)
+	cacheSecretInfo, err := client.getCacheSecretInfo("cache_client")
+	assert.Nil(t, err)
+	assert.Equal(t, defaultTtl, client.getCacheTTL(cacheSecretInfo))
+}
+
+func TestSecretCacheClient_UnwatchWhileWaiting(t *testing.T) {
+	fake := newFakeSecretManagerClient()
+	fake.putSecret("cache_client", "v1", "value1")
+	client := newFakeCacheClient(t, fake)
+	defer client.Close()
+
+	block := make(chan struct{})
+	fake.setBlock(block)
+	refreshDone := make(chan error, 1)
+	go func() {
+		_, err := client.RefreshNow("cache_client")
+		refreshDone <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	// Unwatch先于GetSecretInfo等待凭据锁
+	unwatchDone := make(chan error, 1)
+	go func() {
+		unwatchDone <- client.Unwatch("cache_client")
+	}()
+	time.Sleep(50 * time.Millisecond)
+	getDone := make(chan error, 1)
+	go func() {
+		_, err := client.GetSecretInfo("cache_client")
+		getDone <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	close(block)
+	assert.Nil(t, <-refreshDone)
+	assert.Nil(t, <-unwatchDone)
+	assert.Nil(t, <-getDone)
+	// 等待期间已被取消监听的请求不再加入刷新
+	assert.False(t, client.scheduledMap.Has("cache_client"))
+	_, err := client.getCacheSecretInfo("cache_client")
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, len(client.secretLockMap))
+
+	// Unwatch之后再次获取重新加入刷新
+	_, err = client.GetSecretInfo("cache_client")
+	assert.Nil(t, err)
+	assert.True(t, client.scheduledMap.Has("cache_client"))
+}
+
+func TestSecretCacheClient_Close(t *testing.T) {
+	fake := newFakeSecretManagerClient()
+	fake.putSecret("cache_client", "v1", "value1")
+	fake.putSecret("cache_client_1", "v1", "value1")
+	client, err := NewSecretCacheClientBuilder(fake).WithSecretTTL("cache_client", 10*1000).Build()
+	assert.Nil(t, err)
+	assert.True(t, client.scheduledMap.Has("cache_client"))
+
+	// Close等待进行中的刷新正常完成
+	block := make(chan struct{})
+	fake.setBlock(block)
+	refreshDone := make(chan error, 1)
+	go func() {
+		_, err := client.RefreshNow("cache_client")
+		refreshDone <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	closeDone := make(chan error, 1)
+	go func() {
+		closeDone <- client.Close()
+	}()
+	select {
+	case <-closeDone:
+		t.Fatal("Close returned before inflight refresh finished")
+	case <-time.After(100 * time.Millisecond):
+	}
+	assert.Equal(t, 0, client.scheduledMap.Count())
+	close(block)
+	assert.Nil(t, <-closeDone)
+	assert.Nil(t, <-refreshDone)
+	assert.Equal(t, 0, client.scheduledMap.Count())
+
+	_, err = client.GetSecretInfo("cache_client")
+	assert.Equal(t, utils.ErrClientClosed, err)
+	_, err = client.RefreshNow("cache_client")
+	assert.Equal(t, utils.ErrClientClosed, err)
+	assert.Nil(t, client.Close())
+}
+
+func TestSecretCacheClient_LockWaitContext(t *testing.T) {
+	fake := newFakeSecretManagerClient()
+	fake.putSecret("cache_client", "v1", "value1")
+	client := newFakeCacheClient(t, fake)
+
+	// 刷新持有凭据锁且请求未设置超时
+	block := make(chan struct{})
+	fake.setBlock(block)
+	refreshDone := make(chan error, 1)
+	go func() {
+		_, err := client.RefreshNow("cache_client")
+		refreshDone <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := client.GetSecretInfoContext(ctx, "cache_client")
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(start) < time.Second)
+
+	close(block)
+	assert.Nil(t, <-refreshDone)
+	secretInfo, err := client.GetSecretInfo("cache_client")
+	assert.Nil(t, err)
+	assert.Equal(t, "value1", secretInfo.SecretValue)
+	assert.Nil(t, client.Close())
+}
+
+func TestSecretCacheClient_CloseContextDeadline(t *testing.T) {
+	fake := newFakeSecretManagerClient()
+	fake.putSecret("cache_client", "v1", "value1")
+	client := newFakeCacheClient(t, fake)
+
+	block := make(chan struct{})
+	fake.setBlock(block)
+	getDone := make(chan error, 1)
+	go func() {
+		_, err := client.GetSecretInfoContext(context.Background(), "cache_client")
+		getDone <- err
+	}()
+	refreshDone := make(chan error, 1)
+	go func() {
+		_, err := client.RefreshNow("cache_client_1")
+		refreshDone <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := client.CloseContext(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	// 等待超时后取消后台刷新
+	assert.Equal(t, context.Canceled, <-refreshDone)
+	close(block)
+	assert.Nil(t, <-getDone)
+}
+
+func TestSecretCacheClient_StaleWhileRevalidate(t *testing.T) {
+	fake := newFakeSecretManagerClient()
+	fake.putSecret("cache_client", "v1", "value1")
+	client, err := NewSecretCacheClientBuilder(fake).WithStaleWhileRevalidate(2 * defaultTtl).Build()
+	assert.Nil(t, err)
+	defer client.Close()
+
+	_, err = client.GetSecretInfo("cache_client")
+	assert.Nil(t, err)
+	cacheSecretInfo, err := client.getCacheSecretInfo("cache_client")
+	assert.Nil(t, err)
+
+	// 过期但在允许范围内，KMS不可用时仍返回旧值
+	fake.setErr(sdkerr.NewClientError(utils.SdkServerUnreachable, "unreachable", errors.New("unreachable")))
+	cacheSecretInfo.RefreshTimestamp -= 2 * defaultTtl
+	info, err := client.GetSecretInfo("cache_client")
+	assert.Nil(t, err)
+	assert.Equal(t, "value1", info.SecretValue)
+
+	// 后台刷新成功后缓存更新为新值
+	fake.setErr(nil)
+	fake.putSecret("cache_client", "v2", "value2")
+	for i := 0; i < 100; i++ {
+		if cacheSecretInfo, err = client.getCacheSecretInfo("cache_client"); err == nil && cacheSecretInfo.SecretInfo.VersionId == "v2" {
+			break
+		}
+		client.GetSecretInfo("cache_client")
+		time.Sleep(10 * time.Millisecond)
+	}
+	info, err = client.GetSecretInfo("cache_client")
+	assert.Nil(t, err)
+	assert.Equal(t, "value2", info.SecretValue)
+
+	// 超出允许范围后同步获取并返回错误
+	fake.setErr(sdkerr.NewClientError(utils.SdkServerUnreachable, "unreachable", errors.New("unreachable")))
+	cacheSecretInfo, err = client.getCacheSecretInfo("cache_client")
+	assert.Nil(t, err)
+	cacheSecretInfo.RefreshTimestamp -= 4 * defaultTtl
+	_, err = client.GetSecretInfo("cache_client")
+	assert.NotNil(t, err)
+}
+
+func TestSecretCacheClient_GetSecretInfos(t *testing.T) {
+	fake := newFakeSecretManagerClient()
+	fake.delay = 20 * time.Millisecond
+	var secretNames []string
+	for i := 0; i < 10; i++ {
+		secretName := fmt.Sprintf("cache_client_%d", i)
+		fake.putSecret(secretName, "v1", secretName)
+		secretNames = append(secretNames, secretName)
+	}
+	client, err := NewSecretCacheClientBuilder(fake).WithMaxConcurrency(3).Build()
+	assert.Nil(t, err)
+	defer client.Close()
+
+	err = client.Prefetch(secretNames[:5]...)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, fake.getCalls())
+
+	secretInfos, err := client.GetSecretInfos(append(secretNames, "not_exist", secretNames[0])...)
+	assert.Equal(t, 10, len(secretInfos))
+	assert.Equal(t, secretNames[9], secretInfos[secretNames[9]].SecretValue)
+	batchErr, ok := err.(*utils.BatchError)
+	assert.True(t, ok)
+	assert.Equal(t, 1, len(batchErr.Errors))
+	assert.NotNil(t, batchErr.Errors["not_exist"])
+	assert.Equal(t, 11, fake.getCalls())
+	assert.True(t, fake.maxRunning <= 3)
+}
+
+func TestSecretCacheClient_InitSecretNames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secretsmanager")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	configFile := filepath.Join(dir, utils.DefaultConfigName)
+	err = ioutil.WriteFile(configFile, []byte("secret_names=cache_client, cache_client_1:60000\n"), 0600)
+	assert.Nil(t, err)
+	os.Setenv(utils.EnvSecretNamesKey, "cache_client_2:30000")
+	defer os.Unsetenv(utils.EnvSecretNamesKey)
+
+	fake := newFakeSecretManagerClient()
+	fake.putSecret("cache_client", "v1", "value")
+	fake.putSecret("cache_client_1", "v1", "value1")
+	fake.putSecret("cache_client_2", "v1", "value2")
+	client, err := NewSecretCacheClientBuilder(fake).WithCustomConfigFile(configFile).WithSecretTTL("cache_client_1", 10000).Build()
+	assert.Nil(t, err)
+	defer client.Close()
+
+	ttl, _ := client.getSecretTTL("cache_client")
+	assert.Equal(t, defaultTtl, ttl)
+	ttl, _ = client.getSecretTTL("cache_client_1")
+	assert.Equal(t, int64(10000), ttl)
+	ttl, _ = client.getSecretTTL("cache_client_2")
+	assert.Equal(t, int64(30000), ttl)
+	for _, secretName := range []string{"cache_client", "cache_client_1", "cache_client_2"} {
+		assert.True(t, client.scheduledMap.Has(secretName))
+	}
+	assert.Equal(t, 3, fake.getCalls())
+
+	_, _, err = utils.ParseSecretNames("cache_client:abc")
+	assert.NotNil(t, err)
+}
+
+// 可获取配置文件路径的fakeSecretManagerClient
+type configFileSecretManagerClient struct {
+	*fakeSecretManagerClient
+	configFile string
+}
+
+func (c *configFileSecretManagerClient) GetCustomConfigFile() string {
+	return c.configFile
+}
+
+func TestSecretCacheClient_InitSecretNamesFromClientConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secretsmanager")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	// 仅读取secret_names，其他配置项不影响凭据名称加载
+	configFile := filepath.Join(dir, "custom.properties")
+	err = ioutil.WriteFile(configFile, []byte("cache_client_region_id=illegal\nsecret_names=cache_client:60000\n"), 0600)
+	assert.Nil(t, err)
+
+	fake := newFakeSecretManagerClient()
+	fake.putSecret("cache_client", "v1", "value")
+	client, err := NewSecretCacheClientBuilder(&configFileSecretManagerClient{fake, configFile}).Build()
+	assert.Nil(t, err)
+	defer client.Close()
+	assert.True(t, client.scheduledMap.Has("cache_client"))
+	assert.Equal(t, 1, fake.getCalls())
+	ttl, ok := client.getSecretTTL("cache_client")
+	assert.True(t, ok)
+	assert.Equal(t, int64(60000), ttl)
+}
+
+func TestSecretCacheClient_TypedErrors(t *testing.T) {
+	fake := newFakeSecretManagerClient()
+	fake.putSecret("cache_client", "v1", "value")
+	client := newFakeCacheClient(t, fake)
+	defer client.Close()
+
+	_, err := client.GetBinaryValue("cache_client")
+	assert.True(t, errors.Is(err, utils.ErrSecretTypeMismatch))
+	var secretErr *utils.SecretError
+	assert.True(t, errors.As(err, &secretErr))
+	assert.Equal(t, "cache_client", secretErr.SecretName)
+
+	_, err = client.GetSecretInfo("")
+	assert.True(t, errors.Is(err, utils.ErrInvalidArgument))
+}
+
+func TestSecretCacheClient_GetSecretInfoByVersionAndStage(t *testing.T) {
+	fake := newFakeSecretManagerClient()
+	fake.putSecret("secret", "v1", "value1")
+	fake.putSecret("secret", "v2", "value2")
+	client := newFakeCacheClient(t, fake)
+	defer client.Close()
+
+	secretInfo, err := client.GetSecretInfoByStage("secret", "ACSPrevious")
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", secretInfo.VersionId)
+	secretInfo, err = client.GetSecretInfoByStage("secret", utils.StageAcsCurrent)
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", secretInfo.VersionId)
+	secretInfo, err = client.GetSecretInfoByVersion("secret", "v1")
+	assert.Nil(t, err)
+	assert.Equal(t, "value1", secretInfo.SecretValue)
+	calls := fake.getCalls()
+
+	// 命中缓存不再远程获取
+	secretInfo, err = client.GetSecretInfoByVersion("secret", "v1")
+	assert.Nil(t, err)
+	assert.Equal(t, "value1", secretInfo.SecretValue)
+	secretInfo, err = client.GetSecretInfoByStage("secret", "ACSPrevious")
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", secretInfo.VersionId)
+	assert.Equal(t, calls, fake.getCalls())
+
+	// 缓存的stage不影响默认stage的缓存
+	secretInfo, err = client.GetSecretInfo("secret")
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", secretInfo.VersionId)
+
+	_, err = client.GetSecretInfoByVersion("secret", "v3")
+	assert.True(t, utils.JudgeErrorCode(err, utils.ErrorCodeForbiddenResourceNotFound))
+	_, err = client.GetSecretInfoByStage("secret", "")
+	assert.True(t, errors.Is(err, utils.ErrInvalidArgument))
+}
+
+func TestSecretCacheClient_GetSecretInfoByVersionLock(t *testing.T) {
+	fake := newFakeSecretManagerClient()
+	fake.putSecret("secret", "v1", "value1")
+	client := newFakeCacheClient(t, fake)
+	defer client.Close()
+
+	// 大量不同版本号的并发获取结束后不保留凭据锁
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			versionId := "v1"
+			if i%2 == 1 {
+				versionId = fmt.Sprintf("not_exist_%d", i)
+			}
+			client.GetSecretInfoByVersion("secret", versionId)
+		}(i)
+	}
+	wg.Wait()
+	client.secretLockMtx.Lock()
+	defer client.secretLockMtx.Unlock()
+	assert.Equal(t, 0, len(client.secretLockMap))
+}
+
+func TestSecretCacheClient_GetSecretInfoByVersionEvict(t *testing.T) {
+	fake := newFakeSecretManagerClient()
+	for i := 1; i <= 3; i++ {
+		fake.putSecret("secret", fmt.Sprintf("v%d", i), fmt.Sprintf("value%d", i))
+	}
+	client, err := NewSecretCacheClientBuilder(fake).WithMaxVersionCacheSize(2).Build()
+	assert.Nil(t, err)
+	defer client.Close()
+
+	_, err = client.GetSecretInfoByVersion("secret", "v1")
+	assert.Nil(t, err)
+	_, err = client.GetSecretInfoByVersion("secret", "v2")
+	assert.Nil(t, err)
+	// 访问v1后v2成为最久未访问的缓存
+	_, err = client.GetSecretInfoByVersion("secret", "v1")
+	assert.Nil(t, err)
+	_, err = client.GetSecretInfoByVersion("secret", "v3")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, client.versionCache.len())
+	_, ok := client.versionCache.get(getVersionCacheKey("secret", "v2", ""))
+	assert.False(t, ok)
+
+	calls := fake.getCalls()
+	_, err = client.GetSecretInfoByVersion("secret", "v1")
+	assert.Nil(t, err)
+	assert.Equal(t, calls, fake.getCalls())
+	// 被淘汰的版本重新远程获取
+	secretInfo, err := client.GetSecretInfoByVersion("secret", "v2")
+	assert.Nil(t, err)
+	assert.Equal(t, "value2", secretInfo.SecretValue)
+	assert.Equal(t, calls+1, fake.getCalls())
+	assert.Equal(t, 2, client.versionCache.len())
+}
+
+func TestSecretCacheClient_GetSecretInfoByStageExpire(t *testing.T) {
+	fake := newFakeSecretManagerClient()
+	fake.putSecret("secret", "v1", "value1")
+	fake.putSecret("secret", "v2", "value2")
+	client, err := NewSecretCacheClientBuilder(fake).WithSecretTTL("secret", 1).Build()
+	assert.Nil(t, err)
+	defer client.Close()
+
+	secretInfo, err := client.GetSecretInfoByStage("secret", "ACSPrevious")
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", secretInfo.VersionId)
+
+	fake.putSecret("secret", "v3", "value3")
+	time.Sleep(10 * time.Millisecond)
+	secretInfo, err = client.GetSecretInfoByStage("secret", "ACSPrevious")
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", secretInfo.VersionId)
+}
+
+func TestSecretCacheClient_ReloadCustomStage(t *testing.T) {
+	cacheSecretPath, err := ioutil.TempDir("", "secret_cache")
+	assert.Nil(t, err)
+	defer os.RemoveAll(cacheSecretPath)
+	fake := newFakeSecretManagerClient()
+	fake.putSecret("secret", "v1", "value1")
+	fake.putSecret("secret", "v2", "value2")
+
+	client, err := NewSecretCacheClientBuilder(fake).WithCacheStage("ACSPrevious").WithCacheSecretStrategy(cache.NewFileCacheSecretStoreStrategy(cacheSecretPath, true, "salt")).Build()
+	assert.Nil(t, err)
+	secretInfo, err := client.GetSecretInfo("secret")
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", secretInfo.VersionId)
+	assert.Nil(t, client.Close())
+
+	// 重启后KMS不可用，从ACSPrevious对应的缓存文件加载
+	fake.setErr(sdkerr.NewServerError(503, `{"Code":"ServiceUnavailableTemporary"}`, ""))
+	client, err = NewSecretCacheClientBuilder(fake).WithCacheStage("ACSPrevious").WithCacheSecretStrategy(cache.NewFileCacheSecretStoreStrategy(cacheSecretPath, true, "salt")).Build()
+	assert.Nil(t, err)
+	defer client.Close()
+	secretInfo, err = client.GetSecretInfo("secret")
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", secretInfo.VersionId)
+	assert.Equal(t, "value1", secretInfo.SecretValue)
+}
+
+func TestSecretCacheClient_FileRecoveryHook(t *testing.T) {
+	cacheSecretPath, err := ioutil.TempDir("", "secret_cache")
+	assert.Nil(t, err)
+	defer os.RemoveAll(cacheSecretPath)
+	fake := newFakeSecretManagerClient()
+	fake.putSecret("secret", "v1", "value1")
+
+	store := cache.NewFileCacheSecretStoreStrategy(cacheSecretPath, true, "salt")
+	client, err := NewSecretCacheClientBuilder(fake).WithCacheSecretStrategy(store).
+		WithSecretCacheHook(cache.NewFileRecoverySecretCacheHook(utils.StageAcsCurrent, store, 300)).
+		WithSecretTTL("secret", 50).Build()
+	assert.Nil(t, err)
+	defer client.Close()
+	secretInfo, err := client.GetSecretInfo("secret")
+	assert.Nil(t, err)
+	assert.False(t, secretInfo.Recovered)
+
+	// KMS不可用时返回文件缓存中的凭据
+	unavailable := sdkerr.NewServerError(503, `{"Code":"ServiceUnavailableTemporary"}`, "")
+	fake.setErr(unavailable)
+	time.Sleep(100 * time.Millisecond)
+	secretInfo, err = client.GetSecretInfo("secret")
+	assert.Nil(t, err)
+	assert.True(t, secretInfo.Recovered)
+	assert.Equal(t, "value1", secretInfo.SecretValue)
+
+	// 超过最大存在时间后返回原始错误
+	time.Sleep(300 * time.Millisecond)
+	_, err = client.GetSecretInfo("secret")
+	assert.True(t, errors.Is(err, unavailable))
+}
@@ -0,0 +1,180 @@
+package sdk
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/models"
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/utils"
+)
+
+const (
+	versionCacheKeySeparator = "\x00"
+	versionCacheKeyVersion   = "version"
+	versionCacheKeyStage     = "stage"
+	// defaultMaxVersionCacheSize 按版本号或stage获取的凭据缓存的默认最大数量
+	defaultMaxVersionCacheSize = 1000
+)
+
+// versionCache 按版本号或非缓存stage获取的凭据缓存，超过容量时淘汰最久未访问的缓存
+type versionCache struct {
+	mtx      sync.Mutex
+	capacity int
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+type versionCacheEntry struct {
+	key             string
+	cacheSecretInfo *models.CacheSecretInfo
+}
+
+func newVersionCache(capacity int) *versionCache {
+	return &versionCache{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (vc *versionCache) get(key string) (*models.CacheSecretInfo, bool) {
+	vc.mtx.Lock()
+	defer vc.mtx.Unlock()
+	elem, ok := vc.items[key]
+	if !ok {
+		return nil, false
+	}
+	vc.ll.MoveToFront(elem)
+	return elem.Value.(*versionCacheEntry).cacheSecretInfo, true
+}
+
+func (vc *versionCache) set(key string, cacheSecretInfo *models.CacheSecretInfo) {
+	vc.mtx.Lock()
+	defer vc.mtx.Unlock()
+	if elem, ok := vc.items[key]; ok {
+		elem.Value.(*versionCacheEntry).cacheSecretInfo = cacheSecretInfo
+		vc.ll.MoveToFront(elem)
+		return
+	}
+	vc.items[key] = vc.ll.PushFront(&versionCacheEntry{key: key, cacheSecretInfo: cacheSecretInfo})
+	for vc.capacity > 0 && vc.ll.Len() > vc.capacity {
+		vc.removeElement(vc.ll.Back())
+	}
+}
+
+// 删除key满足match的缓存
+func (vc *versionCache) removeIf(match func(key string) bool) {
+	vc.mtx.Lock()
+	defer vc.mtx.Unlock()
+	for key, elem := range vc.items {
+		if match(key) {
+			vc.removeElement(elem)
+		}
+	}
+}
+
+func (vc *versionCache) len() int {
+	vc.mtx.Lock()
+	defer vc.mtx.Unlock()
+	return vc.ll.Len()
+}
+
+func (vc *versionCache) removeElement(elem *list.Element) {
+	vc.ll.Remove(elem)
+	delete(vc.items, elem.Value.(*versionCacheEntry).key)
+}
+
+// 根据凭据名称及版本号获取secretInfo信息，版本内容不可变，缓存后不再过期，超过WithMaxVersionCacheSize指定的数量时淘汰最久未访问的缓存
+func (scc *SecretManagerCacheClient) GetSecretInfoByVersion(secretName, versionId string) (*models.SecretInfo, error) {
+	return scc.GetSecretInfoByVersionContext(context.Background(), secretName, versionId)
+}
+
+// 根据凭据名称及版本号获取secretInfo信息，缓存未命中时远程获取凭据受ctx的超时与取消控制
+func (scc *SecretManagerCacheClient) GetSecretInfoByVersionContext(ctx context.Context, secretName, versionId string) (*models.SecretInfo, error) {
+	if secretName == "" || versionId == "" {
+		return nil, &utils.SecretError{SecretName: secretName, Message: "the argument secretName and versionId must not be empty", Err: utils.ErrInvalidArgument}
+	}
+	return scc.getVersionSecretInfo(ctx, secretName, versionId, "")
+}
+
+// 根据凭据名称及stage获取secretInfo信息，stage与WithCacheStage指定的一致时等同于GetSecretInfo
+func (scc *SecretManagerCacheClient) GetSecretInfoByStage(secretName, stage string) (*models.SecretInfo, error) {
+	return scc.GetSecretInfoByStageContext(context.Background(), secretName, stage)
+}
+
+// 根据凭据名称及stage获取secretInfo信息，缓存按凭据TTL过期，缓存未命中时远程获取凭据受ctx的超时与取消控制
+func (scc *SecretManagerCacheClient) GetSecretInfoByStageContext(ctx context.Context, secretName, stage string) (*models.SecretInfo, error) {
+	if secretName == "" || stage == "" {
+		return nil, &utils.SecretError{SecretName: secretName, Message: "the argument secretName and stage must not be empty", Err: utils.ErrInvalidArgument}
+	}
+	if stage == scc.stage {
+		return scc.GetSecretInfoContext(ctx, secretName)
+	}
+	return scc.getVersionSecretInfo(ctx, secretName, "", stage)
+}
+
+func (scc *SecretManagerCacheClient) getVersionSecretInfo(ctx context.Context, secretName, versionId, stage string) (*models.SecretInfo, error) {
+	if err := scc.acquire(); err != nil {
+		return nil, err
+	}
+	defer scc.release()
+	key := getVersionCacheKey(secretName, versionId, stage)
+	if cacheSecretInfo, ok := scc.getVersionCache(key, versionId); ok {
+		return scc.cacheHook.Get(cacheSecretInfo)
+	}
+	unlock, err := scc.lockSecret(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if cacheSecretInfo, ok := scc.getVersionCache(key, versionId); ok {
+		return scc.cacheHook.Get(cacheSecretInfo)
+	}
+	secretInfo, err := scc.requestSecretValue(ctx, secretName, versionId, stage)
+	if err != nil {
+		return nil, err
+	}
+	cacheSecretInfo, err := scc.cacheHook.Put(secretInfo)
+	if err != nil {
+		return nil, err
+	}
+	if cacheSecretInfo == nil {
+		return nil, errors.New(fmt.Sprintf("cacheSecretInfo is nil"))
+	}
+	// hook按缓存stage构建，这里替换为实际获取的stage
+	cacheSecretInfo.Stage = stage
+	scc.versionCache.set(key, cacheSecretInfo)
+	return cacheSecretInfo.SecretInfo, nil
+}
+
+// 获取未过期的缓存，版本号对应的缓存不过期
+func (scc *SecretManagerCacheClient) getVersionCache(key, versionId string) (*models.CacheSecretInfo, bool) {
+	cacheSecretInfo, ok := scc.versionCache.get(key)
+	if !ok {
+		return nil, false
+	}
+	if versionId == "" && scc.judgeCacheExpire(cacheSecretInfo) {
+		return nil, false
+	}
+	return cacheSecretInfo, true
+}
+
+// 删除凭据按stage获取的缓存，includeVersion为true时同时删除按版本号获取的缓存
+func (scc *SecretManagerCacheClient) removeVersionCache(secretName string, includeVersion bool) {
+	stagePrefix := secretName + versionCacheKeySeparator + versionCacheKeyStage + versionCacheKeySeparator
+	versionPrefix := secretName + versionCacheKeySeparator + versionCacheKeyVersion + versionCacheKeySeparator
+	scc.versionCache.removeIf(func(key string) bool {
+		return strings.HasPrefix(key, stagePrefix) || (includeVersion && strings.HasPrefix(key, versionPrefix))
+	})
+}
+
+func getVersionCacheKey(secretName, versionId, stage string) string {
+	if versionId != "" {
+		return strings.Join([]string{secretName, versionCacheKeyVersion, versionId}, versionCacheKeySeparator)
+	}
+	return strings.Join([]string{secretName, versionCacheKeyStage, stage}, versionCacheKeySeparator)
+}
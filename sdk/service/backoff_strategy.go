@@ -1,8 +1,12 @@
 package service
 
 import (
-	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/utils"
 	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/utils"
 )
 
 // BackoffStrategy 规避重试策略接口
@@ -14,6 +18,46 @@ type BackoffStrategy interface {
 	GetWaitTimeExponential(retryTimes int) int64
 }
 
+// BackoffSequenceStrategy 等待时间依赖同一重试序列中上一次等待时间的规避重试策略，每次重试开始时创建新的重试序列
+type BackoffSequenceStrategy interface {
+	BackoffStrategy
+
+	// 创建新的重试序列
+	NewBackoffSequence() BackoffSequence
+}
+
+// BackoffSequence 一次重试过程的规避等待状态，非并发安全
+type BackoffSequence interface {
+	// 获取本次重试的规避等待时间，时间单位MS，小于0表示不再重试
+	NextWaitTime(retryTimes int) int64
+}
+
+// RandomSource 随机数来源，可注入固定的随机数用于测试
+type RandomSource interface {
+	// 返回[0,n)范围内的随机数，n必须大于0
+	Int63n(n int64) int64
+}
+
+// lockedRandomSource 并发安全的随机数来源
+type lockedRandomSource struct {
+	mtx sync.Mutex
+	rnd *rand.Rand
+}
+
+func (lrs *lockedRandomSource) Int63n(n int64) int64 {
+	lrs.mtx.Lock()
+	defer lrs.mtx.Unlock()
+	return lrs.rnd.Int63n(n)
+}
+
+func newDefaultRandomSource() RandomSource {
+	return &lockedRandomSource{rnd: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+// 未指定随机数来源时共享的默认随机数来源
+var defaultRandomSource = newDefaultRandomSource()
+
+// FullJitterBackoffStrategy 等待时间为[0, min(Capacity, 2^retryTimes*RetryInitialIntervalMills)]范围内的随机值
 type FullJitterBackoffStrategy struct {
 	//重试最大尝试次数
 	RetryMaxAttempts int
@@ -31,22 +75,204 @@ func NewFullJitterBackoffStrategy(retryMaxAttempts int, retryInitialIntervalMill
 	}
 }
 
+// NewFullJitterBackoffStrategyWithRandomSource 使用指定随机数来源的FullJitterBackoffStrategy，可注入固定的随机数用于测试
+func NewFullJitterBackoffStrategyWithRandomSource(retryMaxAttempts int, retryInitialIntervalMills int64, capacity int64, random RandomSource) BackoffStrategy {
+	return newRandomBackoffStrategy(NewFullJitterBackoffStrategy(retryMaxAttempts, retryInitialIntervalMills, capacity), random)
+}
+
 func (fbs *FullJitterBackoffStrategy) Init() error {
-	if fbs.RetryMaxAttempts == 0 {
-		fbs.RetryMaxAttempts = utils.DefaultRetryMaxAttempts
+	initBackoffParams(&fbs.RetryMaxAttempts, &fbs.RetryInitialIntervalMills, &fbs.Capacity)
+	return nil
+}
+
+func (fbs *FullJitterBackoffStrategy) GetWaitTimeExponential(retryTimes int) int64 {
+	return fbs.getWaitTime(retryTimes, 0, defaultRandomSource)
+}
+
+func (fbs *FullJitterBackoffStrategy) NewBackoffSequence() BackoffSequence {
+	return &backoffSequence{strategy: fbs, random: defaultRandomSource}
+}
+
+func (fbs *FullJitterBackoffStrategy) getWaitTime(retryTimes int, prevWaitTime int64, random RandomSource) int64 {
+	if retryTimes > fbs.RetryMaxAttempts {
+		return -1
 	}
-	if fbs.RetryInitialIntervalMills == 0 {
-		fbs.RetryInitialIntervalMills = utils.DefaultRetryInitialIntervalMills
+	ceiling := exponentialCeiling(2, retryTimes, fbs.RetryInitialIntervalMills, fbs.Capacity)
+	return random.Int63n(ceiling + 1)
+}
+
+// EqualJitterBackoffStrategy 等待时间为指数退避时间的一半加上[0, 一半]范围内的随机值
+type EqualJitterBackoffStrategy struct {
+	//重试最大尝试次数
+	RetryMaxAttempts int
+	// 重试时间间隔，单位ms
+	RetryInitialIntervalMills int64
+	// 最大等待时间，单位ms
+	Capacity int64
+}
+
+func NewEqualJitterBackoffStrategy(retryMaxAttempts int, retryInitialIntervalMills int64, capacity int64) *EqualJitterBackoffStrategy {
+	return &EqualJitterBackoffStrategy{
+		RetryMaxAttempts:          retryMaxAttempts,
+		RetryInitialIntervalMills: retryInitialIntervalMills,
+		Capacity:                  capacity,
 	}
-	if fbs.Capacity == 0 {
-		fbs.Capacity = utils.DefaultCapacity
+}
+
+// NewEqualJitterBackoffStrategyWithRandomSource 使用指定随机数来源的EqualJitterBackoffStrategy，可注入固定的随机数用于测试
+func NewEqualJitterBackoffStrategyWithRandomSource(retryMaxAttempts int, retryInitialIntervalMills int64, capacity int64, random RandomSource) BackoffStrategy {
+	return newRandomBackoffStrategy(NewEqualJitterBackoffStrategy(retryMaxAttempts, retryInitialIntervalMills, capacity), random)
+}
+
+func (ebs *EqualJitterBackoffStrategy) Init() error {
+	initBackoffParams(&ebs.RetryMaxAttempts, &ebs.RetryInitialIntervalMills, &ebs.Capacity)
+	return nil
+}
+
+func (ebs *EqualJitterBackoffStrategy) GetWaitTimeExponential(retryTimes int) int64 {
+	return ebs.getWaitTime(retryTimes, 0, defaultRandomSource)
+}
+
+func (ebs *EqualJitterBackoffStrategy) NewBackoffSequence() BackoffSequence {
+	return &backoffSequence{strategy: ebs, random: defaultRandomSource}
+}
+
+func (ebs *EqualJitterBackoffStrategy) getWaitTime(retryTimes int, prevWaitTime int64, random RandomSource) int64 {
+	if retryTimes > ebs.RetryMaxAttempts {
+		return -1
 	}
+	half := exponentialCeiling(2, retryTimes, ebs.RetryInitialIntervalMills, ebs.Capacity) / 2
+	return half + random.Int63n(half+1)
+}
+
+// DecorrelatedJitterBackoffStrategy 等待时间为[RetryInitialIntervalMills, min(Capacity, 3*上一次等待时间)]范围内的随机值，
+// 上一次等待时间保存在每次重试创建的BackoffSequence中
+type DecorrelatedJitterBackoffStrategy struct {
+	//重试最大尝试次数
+	RetryMaxAttempts int
+	// 重试时间间隔，单位ms
+	RetryInitialIntervalMills int64
+	// 最大等待时间，单位ms
+	Capacity int64
+}
+
+func NewDecorrelatedJitterBackoffStrategy(retryMaxAttempts int, retryInitialIntervalMills int64, capacity int64) *DecorrelatedJitterBackoffStrategy {
+	return &DecorrelatedJitterBackoffStrategy{
+		RetryMaxAttempts:          retryMaxAttempts,
+		RetryInitialIntervalMills: retryInitialIntervalMills,
+		Capacity:                  capacity,
+	}
+}
+
+// NewDecorrelatedJitterBackoffStrategyWithRandomSource 使用指定随机数来源的DecorrelatedJitterBackoffStrategy，可注入固定的随机数用于测试
+func NewDecorrelatedJitterBackoffStrategyWithRandomSource(retryMaxAttempts int, retryInitialIntervalMills int64, capacity int64, random RandomSource) BackoffStrategy {
+	return newRandomBackoffStrategy(NewDecorrelatedJitterBackoffStrategy(retryMaxAttempts, retryInitialIntervalMills, capacity), random)
+}
+
+func (dbs *DecorrelatedJitterBackoffStrategy) Init() error {
+	initBackoffParams(&dbs.RetryMaxAttempts, &dbs.RetryInitialIntervalMills, &dbs.Capacity)
 	return nil
 }
 
-func (fbs *FullJitterBackoffStrategy) GetWaitTimeExponential(retryTimes int) int64 {
-	if retryTimes > fbs.RetryMaxAttempts {
+// GetWaitTimeExponential 没有重试序列时上一次等待时间按RetryInitialIntervalMills计算，需要去相关的等待时间请使用NewBackoffSequence
+func (dbs *DecorrelatedJitterBackoffStrategy) GetWaitTimeExponential(retryTimes int) int64 {
+	return dbs.getWaitTime(retryTimes, 0, defaultRandomSource)
+}
+
+func (dbs *DecorrelatedJitterBackoffStrategy) NewBackoffSequence() BackoffSequence {
+	return &backoffSequence{strategy: dbs, random: defaultRandomSource}
+}
+
+func (dbs *DecorrelatedJitterBackoffStrategy) getWaitTime(retryTimes int, prevWaitTime int64, random RandomSource) int64 {
+	if retryTimes > dbs.RetryMaxAttempts {
 		return -1
 	}
-	return int64(math.Min(float64(fbs.Capacity), math.Pow(2, float64(retryTimes))*float64(fbs.RetryInitialIntervalMills)))
+	base := int64(math.Min(float64(dbs.RetryInitialIntervalMills), float64(dbs.Capacity)))
+	if prevWaitTime < base {
+		prevWaitTime = base
+	}
+	ceiling := int64(math.Min(float64(dbs.Capacity), float64(prevWaitTime)*3))
+	return base + random.Int63n(ceiling-base+1)
+}
+
+// jitterBackoffStrategy 可指定随机数来源及上一次等待时间计算等待时间的规避重试策略
+type jitterBackoffStrategy interface {
+	Init() error
+
+	getWaitTime(retryTimes int, prevWaitTime int64, random RandomSource) int64
+}
+
+// randomBackoffStrategy 使用指定随机数来源的规避重试策略，
+// 各策略结构体保持只有公开字段，兼容未指定字段名的结构体字面量
+type randomBackoffStrategy struct {
+	strategy jitterBackoffStrategy
+	random   RandomSource
+}
+
+func newRandomBackoffStrategy(strategy jitterBackoffStrategy, random RandomSource) BackoffStrategy {
+	if random == nil {
+		random = defaultRandomSource
+	}
+	return &randomBackoffStrategy{strategy: strategy, random: random}
+}
+
+func (rbs *randomBackoffStrategy) Init() error {
+	return rbs.strategy.Init()
+}
+
+func (rbs *randomBackoffStrategy) GetWaitTimeExponential(retryTimes int) int64 {
+	return rbs.strategy.getWaitTime(retryTimes, 0, rbs.random)
+}
+
+func (rbs *randomBackoffStrategy) NewBackoffSequence() BackoffSequence {
+	return &backoffSequence{strategy: rbs.strategy, random: rbs.random}
+}
+
+// backoffSequence 记录上一次等待时间的重试序列
+type backoffSequence struct {
+	strategy     jitterBackoffStrategy
+	random       RandomSource
+	prevWaitTime int64
+}
+
+func (bs *backoffSequence) NextWaitTime(retryTimes int) int64 {
+	waitTime := bs.strategy.getWaitTime(retryTimes, bs.prevWaitTime, bs.random)
+	if waitTime >= 0 {
+		bs.prevWaitTime = waitTime
+	}
+	return waitTime
+}
+
+// statelessBackoffSequence 未实现BackoffSequenceStrategy的规避重试策略的重试序列
+type statelessBackoffSequence struct {
+	strategy BackoffStrategy
+}
+
+func (sbs statelessBackoffSequence) NextWaitTime(retryTimes int) int64 {
+	return sbs.strategy.GetWaitTimeExponential(retryTimes)
+}
+
+// 创建一次重试过程使用的重试序列
+func newBackoffSequence(strategy BackoffStrategy) BackoffSequence {
+	if sequenceStrategy, ok := strategy.(BackoffSequenceStrategy); ok {
+		return sequenceStrategy.NewBackoffSequence()
+	}
+	return statelessBackoffSequence{strategy: strategy}
+}
+
+func initBackoffParams(retryMaxAttempts *int, retryInitialIntervalMills *int64, capacity *int64) {
+	if *retryMaxAttempts == 0 {
+		*retryMaxAttempts = utils.DefaultRetryMaxAttempts
+	}
+	if *retryInitialIntervalMills == 0 {
+		*retryInitialIntervalMills = utils.DefaultRetryInitialIntervalMills
+	}
+	if *capacity == 0 {
+		*capacity = utils.DefaultCapacity
+	}
+}
+
+// 计算min(capacity, factor^retryTimes*initialIntervalMills)
+func exponentialCeiling(factor float64, retryTimes int, initialIntervalMills int64, capacity int64) int64 {
+	return int64(math.Min(float64(capacity), math.Pow(factor, float64(retryTimes))*float64(initialIntervalMills)))
 }
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// maxRandomSource 总是返回最大值
+type maxRandomSource struct{}
+
+func (maxRandomSource) Int63n(n int64) int64 {
+	return n - 1
+}
+
+// zeroRandomSource 总是返回0
+type zeroRandomSource struct{}
+
+func (zeroRandomSource) Int63n(n int64) int64 {
+	return 0
+}
+
+func TestFullJitterBackoffStrategy(t *testing.T) {
+	strategy := NewFullJitterBackoffStrategyWithRandomSource(3, 100, 500, maxRandomSource{})
+	assert.Nil(t, strategy.Init())
+	assert.Equal(t, int64(100), strategy.GetWaitTimeExponential(0))
+	assert.Equal(t, int64(200), strategy.GetWaitTimeExponential(1))
+	assert.Equal(t, int64(400), strategy.GetWaitTimeExponential(2))
+	assert.Equal(t, int64(500), strategy.GetWaitTimeExponential(3))
+	assert.Equal(t, int64(-1), strategy.GetWaitTimeExponential(4))
+
+	strategy = NewFullJitterBackoffStrategyWithRandomSource(3, 100, 500, zeroRandomSource{})
+	assert.Nil(t, strategy.Init())
+	assert.Equal(t, int64(0), strategy.GetWaitTimeExponential(2))
+}
+
+func TestFullJitterBackoffStrategy_Default(t *testing.T) {
+	strategy := &FullJitterBackoffStrategy{}
+	assert.Nil(t, strategy.Init())
+	waitTimes := make(map[int64]bool)
+	for i := 0; i < 20; i++ {
+		waitTime := strategy.GetWaitTimeExponential(2)
+		assert.True(t, waitTime >= 0 && waitTime <= 8000)
+		waitTimes[waitTime] = true
+	}
+	// 默认策略的等待时间是随机的
+	assert.True(t, len(waitTimes) > 1)
+}
+
+func TestEqualJitterBackoffStrategy(t *testing.T) {
+	strategy := NewEqualJitterBackoffStrategyWithRandomSource(3, 100, 500, zeroRandomSource{})
+	assert.Nil(t, strategy.Init())
+	assert.Equal(t, int64(50), strategy.GetWaitTimeExponential(0))
+	assert.Equal(t, int64(200), strategy.GetWaitTimeExponential(2))
+	assert.Equal(t, int64(250), strategy.GetWaitTimeExponential(3))
+
+	strategy = NewEqualJitterBackoffStrategyWithRandomSource(3, 100, 500, maxRandomSource{})
+	assert.Nil(t, strategy.Init())
+	assert.Equal(t, int64(400), strategy.GetWaitTimeExponential(2))
+	assert.Equal(t, int64(-1), strategy.GetWaitTimeExponential(4))
+}
+
+// recordingRandomSource 依次返回values中的值，并记录每次调用的n
+type recordingRandomSource struct {
+	values []int64
+	ns     []int64
+}
+
+func (r *recordingRandomSource) Int63n(n int64) int64 {
+	r.ns = append(r.ns, n)
+	value := r.values[0]
+	r.values = r.values[1:]
+	if value >= n {
+		return n - 1
+	}
+	return value
+}
+
+func TestDecorrelatedJitterBackoffStrategy(t *testing.T) {
+	random := &recordingRandomSource{values: []int64{50, 0, 1000, 0}}
+	strategy := NewDecorrelatedJitterBackoffStrategyWithRandomSource(3, 100, 1000, random)
+	assert.Nil(t, strategy.Init())
+	sequence := strategy.(BackoffSequenceStrategy).NewBackoffSequence()
+	// 首次上一次等待时间按初始间隔计算，范围为[100, 300]
+	assert.Equal(t, int64(150), sequence.NextWaitTime(0))
+	// 上一次等待150，范围为[100, 450]
+	assert.Equal(t, int64(100), sequence.NextWaitTime(1))
+	// 上一次等待100，范围为[100, 300]
+	assert.Equal(t, int64(300), sequence.NextWaitTime(2))
+	// 上一次等待300，范围为[100, min(1000, 900)]
+	assert.Equal(t, int64(100), sequence.NextWaitTime(3))
+	assert.Equal(t, int64(-1), sequence.NextWaitTime(4))
+	assert.Equal(t, []int64{201, 351, 201, 801}, random.ns)
+
+	// 每个重试序列的状态互不影响
+	strategy = NewDecorrelatedJitterBackoffStrategyWithRandomSource(3, 100, 1000, maxRandomSource{})
+	assert.Nil(t, strategy.Init())
+	first := strategy.(BackoffSequenceStrategy).NewBackoffSequence()
+	assert.Equal(t, int64(300), first.NextWaitTime(0))
+	assert.Equal(t, int64(900), first.NextWaitTime(1))
+	assert.Equal(t, int64(1000), first.NextWaitTime(2))
+	second := strategy.(BackoffSequenceStrategy).NewBackoffSequence()
+	assert.Equal(t, int64(300), second.NextWaitTime(0))
+
+	// 未指定随机数来源时使用默认随机数来源
+	defaultStrategy := NewDecorrelatedJitterBackoffStrategy(3, 100, 500)
+	assert.Nil(t, defaultStrategy.Init())
+	waitTime := defaultStrategy.NewBackoffSequence().NextWaitTime(0)
+	assert.True(t, waitTime >= 100 && waitTime <= 300)
+	waitTime = defaultStrategy.GetWaitTimeExponential(2)
+	assert.True(t, waitTime >= 100 && waitTime <= 300)
+}
+
+func TestNewBackoffSequence_StatelessStrategy(t *testing.T) {
+	sequence := newBackoffSequence(firstRetryBackoffStrategy{})
+	assert.Equal(t, int64(0), sequence.NextWaitTime(0))
+	assert.Equal(t, int64(60000), sequence.NextWaitTime(1))
+}
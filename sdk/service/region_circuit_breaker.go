@@ -0,0 +1,132 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/models"
+)
+
+// CircuitBreakerState 地域熔断器状态
+type CircuitBreakerState int
+
+const (
+	// 关闭状态，正常请求
+	CircuitBreakerClosed CircuitBreakerState = iota
+	// 打开状态，跳过该地域
+	CircuitBreakerOpen
+	// 半开状态，允许单个探测请求
+	CircuitBreakerHalfOpen
+)
+
+func (s CircuitBreakerState) String() string {
+	switch s {
+	case CircuitBreakerClosed:
+		return "closed"
+	case CircuitBreakerOpen:
+		return "open"
+	case CircuitBreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// RegionCircuitBreakerState 地域熔断器的监控信息
+type RegionCircuitBreakerState struct {
+	RegionInfo *models.RegionInfo
+	State      CircuitBreakerState
+	// 连续失败次数
+	ConsecutiveFailures int
+	// 最近一次打开的时间，单位ms
+	OpenedTimestamp int64
+}
+
+// CircuitBreakerStatsProvider 提供各地域熔断器状态
+type CircuitBreakerStatsProvider interface {
+	// 获取各地域熔断器状态
+	GetCircuitBreakerStates() []*RegionCircuitBreakerState
+}
+
+type regionCircuitBreaker struct {
+	mtx sync.Mutex
+	// 连续失败达到该次数后打开
+	failureThreshold int
+	// 打开后经过该时间进入半开状态，单位ms
+	openTimeoutMills    int64
+	state               CircuitBreakerState
+	consecutiveFailures int
+	openedTimestamp     int64
+	probing             bool
+}
+
+func newRegionCircuitBreaker(failureThreshold int, openTimeoutMills int64) *regionCircuitBreaker {
+	return &regionCircuitBreaker{
+		failureThreshold: failureThreshold,
+		openTimeoutMills: openTimeoutMills,
+	}
+}
+
+// 判断是否允许请求，打开超时后进入半开状态并只放行一个探测请求
+func (cb *regionCircuitBreaker) tryAcquire() bool {
+	cb.mtx.Lock()
+	defer cb.mtx.Unlock()
+	switch cb.state {
+	case CircuitBreakerOpen:
+		if time.Now().UnixNano()/1e6-cb.openedTimestamp < cb.openTimeoutMills {
+			return false
+		}
+		cb.state = CircuitBreakerHalfOpen
+		cb.probing = true
+		return true
+	case CircuitBreakerHalfOpen:
+		if cb.probing {
+			return false
+		}
+		cb.probing = true
+		return true
+	}
+	return true
+}
+
+// 判断是否可用，不改变熔断器状态
+func (cb *regionCircuitBreaker) available() bool {
+	cb.mtx.Lock()
+	defer cb.mtx.Unlock()
+	switch cb.state {
+	case CircuitBreakerOpen:
+		return time.Now().UnixNano()/1e6-cb.openedTimestamp >= cb.openTimeoutMills
+	case CircuitBreakerHalfOpen:
+		return !cb.probing
+	}
+	return true
+}
+
+func (cb *regionCircuitBreaker) recordSuccess() {
+	cb.mtx.Lock()
+	defer cb.mtx.Unlock()
+	cb.state = CircuitBreakerClosed
+	cb.consecutiveFailures = 0
+	cb.probing = false
+}
+
+func (cb *regionCircuitBreaker) recordFailure() {
+	cb.mtx.Lock()
+	defer cb.mtx.Unlock()
+	cb.consecutiveFailures++
+	cb.probing = false
+	if cb.state == CircuitBreakerHalfOpen || cb.consecutiveFailures >= cb.failureThreshold {
+		cb.state = CircuitBreakerOpen
+		cb.openedTimestamp = time.Now().UnixNano() / 1e6
+	}
+}
+
+func (cb *regionCircuitBreaker) getState(regionInfo *models.RegionInfo) *RegionCircuitBreakerState {
+	cb.mtx.Lock()
+	defer cb.mtx.Unlock()
+	return &RegionCircuitBreakerState{
+		RegionInfo:          regionInfo,
+		State:               cb.state,
+		ConsecutiveFailures: cb.consecutiveFailures,
+		OpenedTimestamp:     cb.openedTimestamp,
+	}
+}
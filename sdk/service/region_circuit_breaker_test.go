@@ -0,0 +1,36 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegionCircuitBreaker(t *testing.T) {
+	cb := newRegionCircuitBreaker(2, 50)
+	assert.True(t, cb.tryAcquire())
+	cb.recordFailure()
+	assert.Equal(t, CircuitBreakerClosed, cb.getState(nil).State)
+	cb.recordFailure()
+	assert.Equal(t, CircuitBreakerOpen, cb.getState(nil).State)
+	assert.False(t, cb.available())
+	assert.False(t, cb.tryAcquire())
+
+	time.Sleep(60 * time.Millisecond)
+	assert.True(t, cb.available())
+	assert.True(t, cb.tryAcquire())
+	assert.Equal(t, CircuitBreakerHalfOpen, cb.getState(nil).State)
+	// 半开状态只放行一个探测请求
+	assert.False(t, cb.tryAcquire())
+	cb.recordFailure()
+	assert.Equal(t, CircuitBreakerOpen, cb.getState(nil).State)
+
+	time.Sleep(60 * time.Millisecond)
+	assert.True(t, cb.tryAcquire())
+	cb.recordSuccess()
+	state := cb.getState(nil)
+	assert.Equal(t, CircuitBreakerClosed, state.State)
+	assert.Equal(t, 0, state.ConsecutiveFailures)
+	assert.Equal(t, "closed", state.State.String())
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"crypto/tls"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/models"
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/utils"
+)
+
+// RegionProber 地域探测接口，用于多地域排序
+type RegionProber interface {
+	// 初始化探测器
+	Init() error
+
+	// 探测地域的访问延迟，单位ms，不可达时返回-1
+	Probe(regionInfo *models.RegionInfo) float64
+}
+
+// TlsRegionProber 通过TCP建连及TLS握手耗时探测KMS服务地址的延迟
+type TlsRegionProber struct {
+	// 单次探测超时时间，单位ms
+	TimeoutMills int64
+	// 采样次数，延迟取成功采样的平均值
+	Samples int
+	// 探测端口
+	Port int
+	// 只探测TCP建连，不进行TLS握手
+	TcpOnly bool
+}
+
+func NewTlsRegionProber(timeoutMills int64, samples int) *TlsRegionProber {
+	return &TlsRegionProber{
+		TimeoutMills: timeoutMills,
+		Samples:      samples,
+	}
+}
+
+func (p *TlsRegionProber) Init() error {
+	if p.TimeoutMills <= 0 {
+		p.TimeoutMills = utils.DefaultProbeTimeoutMills
+	}
+	if p.Samples <= 0 {
+		p.Samples = utils.DefaultProbeSamples
+	}
+	if p.Port <= 0 {
+		p.Port = utils.DefaultProbePort
+	}
+	return nil
+}
+
+func (p *TlsRegionProber) Probe(regionInfo *models.RegionInfo) float64 {
+	address := p.getAddress(getRegionEndpoint(regionInfo))
+	var total float64
+	var succeeded int
+	for i := 0; i < p.Samples; i++ {
+		delay, err := p.probeOnce(address)
+		if err != nil {
+			continue
+		}
+		total += delay
+		succeeded++
+	}
+	if succeeded == 0 {
+		return -1
+	}
+	return total / float64(succeeded)
+}
+
+func (p *TlsRegionProber) probeOnce(address string) (float64, error) {
+	timeout := time.Duration(p.TimeoutMills) * time.Millisecond
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return -1, err
+	}
+	defer conn.Close()
+	if !p.TcpOnly {
+		host, _, _ := net.SplitHostPort(address)
+		// 只测量握手耗时，不传输数据，专属KMS使用私有CA，因此不校验证书
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: host, InsecureSkipVerify: true})
+		err = tlsConn.SetDeadline(start.Add(timeout))
+		if err != nil {
+			return -1, err
+		}
+		err = tlsConn.Handshake()
+		if err != nil {
+			return -1, err
+		}
+	}
+	return float64(time.Since(start)) / float64(time.Millisecond), nil
+}
+
+// endpoint未指定端口时使用探测端口
+func (p *TlsRegionProber) getAddress(endpoint string) string {
+	if _, _, err := net.SplitHostPort(endpoint); err == nil {
+		return endpoint
+	}
+	return net.JoinHostPort(endpoint, strconv.Itoa(p.Port))
+}
+
+// 获取地域对应的KMS服务地址
+func getRegionEndpoint(regionInfo *models.RegionInfo) string {
+	if regionInfo.Endpoint != "" {
+		return regionInfo.Endpoint
+	} else if regionInfo.Vpc {
+		return utils.GetVpcEndpoint(regionInfo.RegionId)
+	}
+	return utils.GetEndpoint(regionInfo.RegionId)
+}
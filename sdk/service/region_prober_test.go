@@ -0,0 +1,65 @@
+package service
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTlsRegionProber_Probe(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	endpoint := strings.TrimPrefix(server.URL, "https://")
+
+	prober := NewTlsRegionProber(1000, 2)
+	assert.Nil(t, prober.Init())
+	assert.True(t, prober.Probe(&models.RegionInfo{RegionId: "region-a", Endpoint: endpoint}) >= 0)
+
+	prober.TcpOnly = true
+	assert.True(t, prober.Probe(&models.RegionInfo{RegionId: "region-a", Endpoint: endpoint}) >= 0)
+}
+
+func TestTlsRegionProber_Unreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	endpoint := listener.Addr().String()
+	assert.Nil(t, listener.Close())
+
+	prober := &TlsRegionProber{TimeoutMills: 200}
+	assert.Nil(t, prober.Init())
+	assert.Equal(t, float64(-1), prober.Probe(&models.RegionInfo{RegionId: "region-a", Endpoint: endpoint}))
+}
+
+func TestTlsRegionProber_GetAddress(t *testing.T) {
+	prober := &TlsRegionProber{}
+	assert.Nil(t, prober.Init())
+	assert.Equal(t, "kms.cn-hangzhou.aliyuncs.com:443", prober.getAddress("kms.cn-hangzhou.aliyuncs.com"))
+	assert.Equal(t, "127.0.0.1:8443", prober.getAddress("127.0.0.1:8443"))
+}
+
+type fakeRegionProber map[string]float64
+
+func (f fakeRegionProber) Init() error {
+	return nil
+}
+
+func (f fakeRegionProber) Probe(regionInfo *models.RegionInfo) float64 {
+	return f[regionInfo.RegionId]
+}
+
+func TestDefaultSecretManagerClientBuilder_SortRegionInfos(t *testing.T) {
+	builder := NewDefaultSecretManagerClientBuilder()
+	builder.WithRegion("region-a", "region-b", "region-c")
+	builder.WithRegionProber(fakeRegionProber{"region-a": -1, "region-b": 30, "region-c": 10})
+	regionInfos := builder.sortRegionInfos(builder.regionInfos)
+	assert.Equal(t, 3, len(regionInfos))
+	assert.Equal(t, "region-c", regionInfos[0].RegionId)
+	assert.Equal(t, "region-b", regionInfos[1].RegionId)
+	assert.Equal(t, "region-a", regionInfos[2].RegionId)
+}
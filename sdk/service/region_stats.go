@@ -0,0 +1,45 @@
+package service
+
+import (
+	"sync"
+)
+
+const (
+	// 指数加权移动平均的平滑系数
+	regionStatsAlpha = 0.2
+
+	// 错误率对排序延迟的放大系数，错误率为1时延迟放大为原来的11倍
+	regionErrorRatePenalty = 10
+)
+
+// regionStats 地域实际请求的延迟与错误率统计，使用指数加权移动平均
+type regionStats struct {
+	mtx          sync.Mutex
+	latencyMills float64
+	errorRate    float64
+	samples      int64
+}
+
+func (rs *regionStats) record(latencyMills float64, failed bool) {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+	var failure float64
+	if failed {
+		failure = 1
+	}
+	if rs.samples == 0 {
+		rs.latencyMills = latencyMills
+		rs.errorRate = failure
+	} else {
+		rs.latencyMills = regionStatsAlpha*latencyMills + (1-regionStatsAlpha)*rs.latencyMills
+		rs.errorRate = regionStatsAlpha*failure + (1-regionStatsAlpha)*rs.errorRate
+	}
+	rs.samples++
+}
+
+// 返回平均延迟、错误率，无请求记录时ok为false
+func (rs *regionStats) snapshot() (latencyMills float64, errorRate float64, ok bool) {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+	return rs.latencyMills, rs.errorRate, rs.samples > 0
+}
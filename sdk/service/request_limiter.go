@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// retryBudget 客户端共享的重试预算，成功请求按比例补充令牌，每次重试消耗一个令牌
+type retryBudget struct {
+	mtx sync.Mutex
+	// 令牌上限，同时也是初始令牌数
+	maxTokens float64
+	// 每次成功请求补充的令牌数，即重试请求与成功请求的比例上限
+	tokenRatio float64
+	tokens     float64
+}
+
+func newRetryBudget(maxTokens int, tokenRatio float64) *retryBudget {
+	return &retryBudget{
+		maxTokens:  float64(maxTokens),
+		tokenRatio: tokenRatio,
+		tokens:     float64(maxTokens),
+	}
+}
+
+// 尝试消耗一个重试令牌
+func (rb *retryBudget) tryAcquire() bool {
+	rb.mtx.Lock()
+	defer rb.mtx.Unlock()
+	if rb.tokens < 1 {
+		return false
+	}
+	rb.tokens--
+	return true
+}
+
+func (rb *retryBudget) recordSuccess() {
+	rb.mtx.Lock()
+	defer rb.mtx.Unlock()
+	rb.tokens = math.Min(rb.maxTokens, rb.tokens+rb.tokenRatio)
+}
+
+// rateLimiter 令牌桶限流器，限制对KMS发起请求的速率
+type rateLimiter struct {
+	mtx    sync.Mutex
+	qps    float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(qps float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		qps:    qps,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// 预占一个令牌，返回需要等待的时间
+func (rl *rateLimiter) reserve() time.Duration {
+	rl.mtx.Lock()
+	defer rl.mtx.Unlock()
+	now := time.Now()
+	rl.tokens = math.Min(rl.burst, rl.tokens+now.Sub(rl.last).Seconds()*rl.qps)
+	rl.last = now
+	rl.tokens--
+	if rl.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-rl.tokens / rl.qps * float64(time.Second))
+}
+
+// 归还预占的令牌
+func (rl *rateLimiter) cancel() {
+	rl.mtx.Lock()
+	defer rl.mtx.Unlock()
+	rl.tokens = math.Min(rl.burst, rl.tokens+1)
+}
+
+// 等待获取令牌，ctx取消或超时时归还令牌并返回ctx.Err()
+func (rl *rateLimiter) wait(ctx context.Context) error {
+	delay := rl.reserve()
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		rl.cancel()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
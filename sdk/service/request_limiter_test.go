@@ -0,0 +1,49 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryBudget(t *testing.T) {
+	rb := newRetryBudget(2, 0.5)
+	assert.True(t, rb.tryAcquire())
+	assert.True(t, rb.tryAcquire())
+	assert.False(t, rb.tryAcquire())
+
+	rb.recordSuccess()
+	assert.False(t, rb.tryAcquire())
+	rb.recordSuccess()
+	assert.True(t, rb.tryAcquire())
+
+	// 补充的令牌不超过上限
+	for i := 0; i < 10; i++ {
+		rb.recordSuccess()
+	}
+	assert.True(t, rb.tryAcquire())
+	assert.True(t, rb.tryAcquire())
+	assert.False(t, rb.tryAcquire())
+}
+
+func TestRateLimiter(t *testing.T) {
+	rl := newRateLimiter(20, 2)
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, rl.wait(context.Background()))
+	}
+	// 突发2个请求后，剩余2个请求按每秒20个的速率放行
+	elapsed := time.Since(start)
+	assert.True(t, elapsed >= 80*time.Millisecond, elapsed)
+	assert.True(t, elapsed < time.Second, elapsed)
+}
+
+func TestRateLimiter_Context(t *testing.T) {
+	rl := newRateLimiter(1, 1)
+	assert.Nil(t, rl.wait(context.Background()))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, rl.wait(ctx))
+}
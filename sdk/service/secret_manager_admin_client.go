@@ -0,0 +1,289 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/logger"
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/models"
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/utils"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/auth"
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/responses"
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/kms"
+)
+
+const (
+	// 分页获取全部凭据时的默认分页大小
+	defaultListPageSize = 100
+)
+
+// SecretManagerAdminClient 凭据写操作及管理接口，defaultSecretManagerClient实现了该接口
+// 专属KMS不支持以下操作，调用时跳过专属KMS地域，PutSecretValue、UpdateSecretVersionStage、RotateSecret
+// 非幂等，只在确认请求未被执行时切换地域
+type SecretManagerAdminClient interface {
+	// 写入凭据新版本
+	PutSecretValue(ctx context.Context, req *kms.PutSecretValueRequest) (*kms.PutSecretValueResponse, error)
+
+	// 获取凭据元数据
+	DescribeSecret(ctx context.Context, req *kms.DescribeSecretRequest) (*kms.DescribeSecretResponse, error)
+
+	// 分页获取凭据列表
+	ListSecrets(ctx context.Context, req *kms.ListSecretsRequest) (*kms.ListSecretsResponse, error)
+
+	// 获取全部凭据，自动翻页
+	ListAllSecrets(ctx context.Context, req *kms.ListSecretsRequest) ([]kms.Secret, error)
+
+	// 获取凭据的所有版本
+	ListSecretVersionIds(ctx context.Context, req *kms.ListSecretVersionIdsRequest) (*kms.ListSecretVersionIdsResponse, error)
+
+	// 更新凭据版本状态
+	UpdateSecretVersionStage(ctx context.Context, req *kms.UpdateSecretVersionStageRequest) (*kms.UpdateSecretVersionStageResponse, error)
+
+	// 手动轮转凭据
+	RotateSecret(ctx context.Context, req *kms.RotateSecretRequest) (*kms.RotateSecretResponse, error)
+}
+
+// actionClient 可发起任意KMS OpenAPI调用的客户端
+type actionClient interface {
+	DoActionWithSigner(request requests.AcsRequest, response responses.AcsResponse, signer auth.Signer) error
+}
+
+// dataEncrypter 直接加密数据的客户端，如专属KMS的KmsTransferClient
+type dataEncrypter interface {
+	Encrypt(request *kms.EncryptRequest) (*kms.EncryptResponse, error)
+}
+
+// dataDecrypter 直接解密数据的客户端，如专属KMS的KmsTransferClient
+type dataDecrypter interface {
+	Decrypt(request *kms.DecryptRequest) (*kms.DecryptResponse, error)
+}
+
+// transferAction 通过专属KMS地域的客户端发起调用，为nil表示专属KMS不支持该操作
+type transferAction func(client interface{}, request requests.AcsRequest) (responses.AcsResponse, error)
+
+func (dmc *defaultSecretManagerClient) PutSecretValue(ctx context.Context, req *kms.PutSecretValueRequest) (*kms.PutSecretValueResponse, error) {
+	resp, err := dmc.doAdminAction(ctx, req.SecretName, false, req, func() requests.AcsRequest {
+		return kms.CreatePutSecretValueRequest()
+	}, func() responses.AcsResponse {
+		return kms.CreatePutSecretValueResponse()
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*kms.PutSecretValueResponse), nil
+}
+
+func (dmc *defaultSecretManagerClient) DescribeSecret(ctx context.Context, req *kms.DescribeSecretRequest) (*kms.DescribeSecretResponse, error) {
+	resp, err := dmc.doAdminAction(ctx, req.SecretName, true, req, func() requests.AcsRequest {
+		return kms.CreateDescribeSecretRequest()
+	}, func() responses.AcsResponse {
+		return kms.CreateDescribeSecretResponse()
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*kms.DescribeSecretResponse), nil
+}
+
+func (dmc *defaultSecretManagerClient) ListSecrets(ctx context.Context, req *kms.ListSecretsRequest) (*kms.ListSecretsResponse, error) {
+	resp, err := dmc.doAdminAction(ctx, "", true, req, func() requests.AcsRequest {
+		return kms.CreateListSecretsRequest()
+	}, func() responses.AcsResponse {
+		return kms.CreateListSecretsResponse()
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*kms.ListSecretsResponse), nil
+}
+
+func (dmc *defaultSecretManagerClient) ListAllSecrets(ctx context.Context, req *kms.ListSecretsRequest) ([]kms.Secret, error) {
+	// 翻页时修改副本，不修改调用方的request
+	pageReq := kms.CreateListSecretsRequest()
+	copyRequest(pageReq, req)
+	if pageReq.PageSize == "" {
+		pageReq.PageSize = requests.NewInteger(defaultListPageSize)
+	}
+	var secrets []kms.Secret
+	for pageNumber := 1; ; pageNumber++ {
+		pageReq.PageNumber = requests.NewInteger(pageNumber)
+		resp, err := dmc.ListSecrets(ctx, pageReq)
+		if err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, resp.SecretList.Secret...)
+		if len(resp.SecretList.Secret) == 0 || len(secrets) >= resp.TotalCount {
+			return secrets, nil
+		}
+	}
+}
+
+func (dmc *defaultSecretManagerClient) ListSecretVersionIds(ctx context.Context, req *kms.ListSecretVersionIdsRequest) (*kms.ListSecretVersionIdsResponse, error) {
+	resp, err := dmc.doAdminAction(ctx, req.SecretName, true, req, func() requests.AcsRequest {
+		return kms.CreateListSecretVersionIdsRequest()
+	}, func() responses.AcsResponse {
+		return kms.CreateListSecretVersionIdsResponse()
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*kms.ListSecretVersionIdsResponse), nil
+}
+
+func (dmc *defaultSecretManagerClient) UpdateSecretVersionStage(ctx context.Context, req *kms.UpdateSecretVersionStageRequest) (*kms.UpdateSecretVersionStageResponse, error) {
+	resp, err := dmc.doAdminAction(ctx, req.SecretName, false, req, func() requests.AcsRequest {
+		return kms.CreateUpdateSecretVersionStageRequest()
+	}, func() responses.AcsResponse {
+		return kms.CreateUpdateSecretVersionStageResponse()
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*kms.UpdateSecretVersionStageResponse), nil
+}
+
+func (dmc *defaultSecretManagerClient) RotateSecret(ctx context.Context, req *kms.RotateSecretRequest) (*kms.RotateSecretResponse, error) {
+	resp, err := dmc.doAdminAction(ctx, req.SecretName, false, req, func() requests.AcsRequest {
+		return kms.CreateRotateSecretRequest()
+	}, func() responses.AcsResponse {
+		return kms.CreateRotateSecretResponse()
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*kms.RotateSecretResponse), nil
+}
+
+// 使用KMS主密钥加密数据，defaultSecretManagerClient实现了cache.KmsCryptoClient，可用于包装文件缓存的数据密钥，
+// 专属KMS地域通过KmsTransferClient调用
+func (dmc *defaultSecretManagerClient) Encrypt(ctx context.Context, req *kms.EncryptRequest) (*kms.EncryptResponse, error) {
+	resp, err := dmc.doAdminAction(ctx, req.KeyId, true, req, func() requests.AcsRequest {
+		return kms.CreateEncryptRequest()
+	}, func() responses.AcsResponse {
+		return kms.CreateEncryptResponse()
+	}, func(client interface{}, request requests.AcsRequest) (responses.AcsResponse, error) {
+		c, ok := client.(dataEncrypter)
+		if !ok {
+			return nil, errors.New("getClient unknown kms client type")
+		}
+		resp, err := c.Encrypt(request.(*kms.EncryptRequest))
+		if err != nil {
+			return nil, err
+		}
+		return resp, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*kms.EncryptResponse), nil
+}
+
+// 使用KMS主密钥解密数据
+func (dmc *defaultSecretManagerClient) Decrypt(ctx context.Context, req *kms.DecryptRequest) (*kms.DecryptResponse, error) {
+	resp, err := dmc.doAdminAction(ctx, "", true, req, func() requests.AcsRequest {
+		return kms.CreateDecryptRequest()
+	}, func() responses.AcsResponse {
+		return kms.CreateDecryptResponse()
+	}, func(client interface{}, request requests.AcsRequest) (responses.AcsResponse, error) {
+		c, ok := client.(dataDecrypter)
+		if !ok {
+			return nil, errors.New("getClient unknown kms client type")
+		}
+		resp, err := c.Decrypt(request.(*kms.DecryptRequest))
+		if err != nil {
+			return nil, err
+		}
+		return resp, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*kms.DecryptResponse), nil
+}
+
+// 按地域顺序依次调用，返回可容灾错误时切换到下一个地域，专属KMS地域通过transfer调用，transfer为nil时直接跳过，
+// 非幂等的写操作只在确认请求未被执行时切换地域，避免同一请求在多个地域重复执行
+func (dmc *defaultSecretManagerClient) doAdminAction(ctx context.Context, secretName string, idempotent bool, request requests.AcsRequest, createRequest func() requests.AcsRequest, createResponse func() responses.AcsResponse, transfer transferAction) (responses.AcsResponse, error) {
+	var errs []*utils.RegionError
+	attempts := 0
+	for _, regionInfo := range dmc.getRegionInfos() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if regionInfo.KmsType == utils.DkmsType && transfer == nil {
+			err := fmt.Errorf("regionId:%s, action:%s, %w", regionInfo.RegionId, request.GetActionName(), utils.ErrOperationNotSupported)
+			errs = append(errs, &utils.RegionError{RegionInfo: regionInfo, Err: err})
+			continue
+		}
+		if attempts > 0 && dmc.retryBudget != nil && !dmc.retryBudget.tryAcquire() {
+			errs = append(errs, &utils.RegionError{RegionInfo: regionInfo, Err: utils.ErrRetryBudgetExhausted})
+			break
+		}
+		attempts++
+		// 每个地域使用新的request，不修改调用方的request
+		regionRequest := createRequest()
+		copyRequest(regionRequest, request)
+		regionRequest.SetScheme("https")
+		var response responses.AcsResponse
+		err := dmc.callRegion(ctx, regionInfo, func() error {
+			var err error
+			response, err = dmc.doAction(secretName, regionInfo, regionRequest, createResponse, transfer)
+			return err
+		})
+		if err == nil {
+			return response, nil
+		}
+		logger.GetCommonLogger(utils.ModeName).Errorf("action:%s, regionInfo:%+v, %+v", request.GetActionName(), regionInfo, err)
+		if !utils.JudgeNeedRecoveryException(err) || (!idempotent && !judgeNotExecuted(err)) {
+			return nil, err
+		}
+		errs = append(errs, &utils.RegionError{RegionInfo: regionInfo, Err: err})
+	}
+	return nil, &utils.MultiRegionError{SecretName: secretName, Errors: errs}
+}
+
+// 判断请求是否确定未被执行，熔断跳过及限流拒绝的请求未到达或未被KMS处理
+func judgeNotExecuted(err error) bool {
+	return errors.Is(err, utils.ErrCircuitOpen) || utils.JudgeErrorCode(err, utils.RejectedThrottling)
+}
+
+// 复制request的请求参数及超时设置，不复制domain、scheme等调用时写入的字段
+func copyRequest(dst, src requests.AcsRequest) {
+	dstValue := reflect.ValueOf(dst).Elem()
+	srcValue := reflect.ValueOf(src).Elem()
+	for i := 0; i < srcValue.NumField(); i++ {
+		if srcValue.Type().Field(i).Anonymous {
+			continue
+		}
+		dstValue.Field(i).Set(srcValue.Field(i))
+	}
+	dst.SetReadTimeout(src.GetReadTimeout())
+	dst.SetConnectTimeout(src.GetConnectTimeout())
+}
+
+func (dmc *defaultSecretManagerClient) doAction(secretName string, regionInfo *models.RegionInfo, request requests.AcsRequest, createResponse func() responses.AcsResponse, transfer transferAction) (responses.AcsResponse, error) {
+	client, err := dmc.getClient(regionInfo)
+	if err != nil {
+		return nil, err
+	}
+	var response responses.AcsResponse
+	if regionInfo.KmsType == utils.DkmsType {
+		if transfer == nil {
+			return nil, fmt.Errorf("regionId:%s, action:%s, %w", regionInfo.RegionId, request.GetActionName(), utils.ErrOperationNotSupported)
+		}
+		response, err = transfer(client, request)
+	} else if c, ok := client.(actionClient); ok {
+		response = createResponse()
+		err = c.DoActionWithSigner(request, response, dmc.signer)
+	} else {
+		return nil, errors.New("getClient unknown kms client type")
+	}
+	if err != nil {
+		return nil, utils.NewKmsError(secretName, regionInfo, utils.TransferErrorToClientError(err))
+	}
+	return response, nil
+}
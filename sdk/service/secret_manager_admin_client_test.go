@@ -0,0 +1,230 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/models"
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/utils"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/auth"
+	sdkerr "github.com/aliyun/alibaba-cloud-sdk-go/sdk/errors"
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/responses"
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/kms"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeActionClient struct {
+	domain  string
+	domains []string
+	schemes []string
+	fn      func(request requests.AcsRequest, response responses.AcsResponse) error
+}
+
+func (f *fakeActionClient) DoActionWithSigner(request requests.AcsRequest, response responses.AcsResponse, signer auth.Signer) error {
+	f.domains = append(f.domains, request.GetDomain())
+	f.schemes = append(f.schemes, request.GetScheme())
+	request.SetDomain(f.domain)
+	return f.fn(request, response)
+}
+
+func newAdminTestClient(t *testing.T, fakes map[string]*fakeActionClient, regionIds ...string) *defaultSecretManagerClient {
+	client := newFailoverTestClient(t, nil, regionIds...)
+	for _, regionInfo := range client.regionInfos {
+		client.clientMap[regionInfo] = fakes[regionInfo.RegionId]
+	}
+	return client
+}
+
+func TestDefaultSecretManagerClient_PutSecretValueFailover(t *testing.T) {
+	throttling := sdkerr.NewServerError(400, `{"Code":"Rejected.Throttling"}`, "")
+	fakes := map[string]*fakeActionClient{
+		"region-a": {domain: "kms.region-a.aliyuncs.com", fn: func(request requests.AcsRequest, response responses.AcsResponse) error {
+			return throttling
+		}},
+		"region-b": {domain: "kms.region-b.aliyuncs.com", fn: func(request requests.AcsRequest, response responses.AcsResponse) error {
+			req := request.(*kms.PutSecretValueRequest)
+			resp := response.(*kms.PutSecretValueResponse)
+			resp.SecretName = req.SecretName
+			resp.VersionId = req.VersionId
+			return nil
+		}},
+	}
+	client := newAdminTestClient(t, fakes, "region-a", "region-b")
+
+	// 限流拒绝的写请求未被执行，可以切换地域
+	var adminClient SecretManagerAdminClient = client
+	req := kms.CreatePutSecretValueRequest()
+	req.SecretName = "secret"
+	req.VersionId = "v2"
+	resp, err := adminClient.PutSecretValue(context.Background(), req)
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", resp.VersionId)
+	// 每个地域使用新的request，不修改调用方的request
+	assert.Equal(t, []string{""}, fakes["region-b"].domains)
+	assert.Equal(t, "", req.GetDomain())
+	// 调用方未设置scheme时强制使用https
+	assert.Equal(t, []string{"https"}, fakes["region-a"].schemes)
+	assert.Equal(t, []string{"https"}, fakes["region-b"].schemes)
+	assert.Equal(t, "", req.GetScheme())
+}
+
+func TestDefaultSecretManagerClient_WriteNoFailover(t *testing.T) {
+	unavailable := sdkerr.NewServerError(503, `{"Code":"ServiceUnavailableTemporary"}`, "")
+	fakes := map[string]*fakeActionClient{
+		"region-a": {fn: func(request requests.AcsRequest, response responses.AcsResponse) error {
+			return unavailable
+		}},
+		"region-b": {fn: func(request requests.AcsRequest, response responses.AcsResponse) error {
+			return nil
+		}},
+	}
+	client := newAdminTestClient(t, fakes, "region-a", "region-b")
+
+	// 无法确认是否已执行的非幂等写操作不切换地域
+	putReq := kms.CreatePutSecretValueRequest()
+	putReq.SecretName = "secret"
+	_, err := client.PutSecretValue(context.Background(), putReq)
+	assert.True(t, errors.Is(err, utils.ErrServiceUnavailable))
+	rotateReq := kms.CreateRotateSecretRequest()
+	rotateReq.SecretName = "secret"
+	_, err = client.RotateSecret(context.Background(), rotateReq)
+	assert.True(t, errors.Is(err, utils.ErrServiceUnavailable))
+	stageReq := kms.CreateUpdateSecretVersionStageRequest()
+	stageReq.SecretName = "secret"
+	_, err = client.UpdateSecretVersionStage(context.Background(), stageReq)
+	assert.True(t, errors.Is(err, utils.ErrServiceUnavailable))
+	assert.Equal(t, 0, len(fakes["region-b"].domains))
+
+	// 幂等的读操作切换地域
+	describeReq := kms.CreateDescribeSecretRequest()
+	describeReq.SecretName = "secret"
+	_, err = client.DescribeSecret(context.Background(), describeReq)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(fakes["region-b"].domains))
+}
+
+func TestDefaultSecretManagerClient_AdminSkipDkms(t *testing.T) {
+	fakes := map[string]*fakeActionClient{
+		"region-a": {fn: func(request requests.AcsRequest, response responses.AcsResponse) error {
+			return nil
+		}},
+	}
+	client := newAdminTestClient(t, fakes, "region-a")
+	dkmsRegionInfo := &models.RegionInfo{RegionId: "dkms", KmsType: utils.DkmsType}
+	client.regionInfos = append([]*models.RegionInfo{dkmsRegionInfo}, client.regionInfos...)
+	client.retryBudget = newRetryBudget(1, 0)
+	client.regionStats = map[*models.RegionInfo]*regionStats{dkmsRegionInfo: {}}
+
+	// 专属KMS地域不发起调用，不记录统计也不消耗重试预算
+	req := kms.CreatePutSecretValueRequest()
+	req.SecretName = "secret"
+	_, err := client.PutSecretValue(context.Background(), req)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(fakes["region-a"].domains))
+	_, _, ok := client.regionStats[dkmsRegionInfo].snapshot()
+	assert.False(t, ok)
+	assert.Equal(t, float64(1), client.retryBudget.tokens)
+}
+
+// fakeTransferClient 模拟专属KMS的KmsTransferClient，只支持加解密
+type fakeTransferClient struct {
+	encryptCount int
+	decryptCount int
+}
+
+func (f *fakeTransferClient) Encrypt(request *kms.EncryptRequest) (*kms.EncryptResponse, error) {
+	f.encryptCount++
+	resp := kms.CreateEncryptResponse()
+	resp.KeyId = request.KeyId
+	resp.CiphertextBlob = "dkms:" + request.Plaintext
+	return resp, nil
+}
+
+func (f *fakeTransferClient) Decrypt(request *kms.DecryptRequest) (*kms.DecryptResponse, error) {
+	f.decryptCount++
+	resp := kms.CreateDecryptResponse()
+	resp.Plaintext = strings.TrimPrefix(request.CiphertextBlob, "dkms:")
+	return resp, nil
+}
+
+func TestDefaultSecretManagerClient_DkmsEncryptDecrypt(t *testing.T) {
+	client := newAdminTestClient(t, map[string]*fakeActionClient{}, "region-a")
+	dkmsRegionInfo := &models.RegionInfo{RegionId: "dkms", KmsType: utils.DkmsType}
+	client.regionInfos = []*models.RegionInfo{dkmsRegionInfo}
+	transferClient := &fakeTransferClient{}
+	client.clientMap[dkmsRegionInfo] = transferClient
+
+	// 加解密通过专属KMS客户端调用
+	encryptReq := kms.CreateEncryptRequest()
+	encryptReq.KeyId = "key"
+	encryptReq.Plaintext = "data"
+	encryptResp, err := client.Encrypt(context.Background(), encryptReq)
+	assert.Nil(t, err)
+	assert.Equal(t, "dkms:data", encryptResp.CiphertextBlob)
+	decryptReq := kms.CreateDecryptRequest()
+	decryptReq.CiphertextBlob = encryptResp.CiphertextBlob
+	decryptResp, err := client.Decrypt(context.Background(), decryptReq)
+	assert.Nil(t, err)
+	assert.Equal(t, "data", decryptResp.Plaintext)
+	assert.Equal(t, 1, transferClient.encryptCount)
+	assert.Equal(t, 1, transferClient.decryptCount)
+
+	// 写操作仍跳过专属KMS地域
+	putReq := kms.CreatePutSecretValueRequest()
+	putReq.SecretName = "secret"
+	_, err = client.PutSecretValue(context.Background(), putReq)
+	assert.True(t, errors.Is(err, utils.ErrOperationNotSupported))
+}
+
+func TestDefaultSecretManagerClient_AdminNotRecoverable(t *testing.T) {
+	notFound := sdkerr.NewServerError(404, `{"Code":"Forbidden.ResourceNotFound"}`, "")
+	fakes := map[string]*fakeActionClient{
+		"region-a": {fn: func(request requests.AcsRequest, response responses.AcsResponse) error {
+			return notFound
+		}},
+		"region-b": {fn: func(request requests.AcsRequest, response responses.AcsResponse) error {
+			return nil
+		}},
+	}
+	client := newAdminTestClient(t, fakes, "region-a", "region-b")
+
+	req := kms.CreateDescribeSecretRequest()
+	req.SecretName = "secret"
+	_, err := client.DescribeSecret(context.Background(), req)
+	assert.True(t, errors.Is(err, utils.ErrSecretNotFound))
+	assert.Equal(t, 0, len(fakes["region-b"].domains))
+}
+
+func TestDefaultSecretManagerClient_ListAllSecrets(t *testing.T) {
+	total := 5
+	fakes := map[string]*fakeActionClient{
+		"region-a": {fn: func(request requests.AcsRequest, response responses.AcsResponse) error {
+			req := request.(*kms.ListSecretsRequest)
+			resp := response.(*kms.ListSecretsResponse)
+			pageNumber, _ := strconv.Atoi(string(req.PageNumber))
+			pageSize, _ := strconv.Atoi(string(req.PageSize))
+			resp.TotalCount = total
+			for i := (pageNumber - 1) * pageSize; i < pageNumber*pageSize && i < total; i++ {
+				resp.SecretList.Secret = append(resp.SecretList.Secret, kms.Secret{SecretName: "secret" + strconv.Itoa(i)})
+			}
+			return nil
+		}},
+	}
+	client := newAdminTestClient(t, fakes, "region-a")
+
+	req := kms.CreateListSecretsRequest()
+	req.PageSize = requests.NewInteger(2)
+	secrets, err := client.ListAllSecrets(context.Background(), req)
+	assert.Nil(t, err)
+	assert.Equal(t, total, len(secrets))
+	assert.Equal(t, "secret4", secrets[4].SecretName)
+	assert.Equal(t, 3, len(fakes["region-a"].domains))
+	// 翻页不修改调用方的request
+	assert.Equal(t, requests.Integer(""), req.PageNumber)
+	assert.Equal(t, requests.NewInteger(2), req.PageSize)
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -27,6 +28,8 @@ import (
 const (
 	// 默认请求等待时间
 	RequestWaitingTime = 10 * 60 * 1000
+	// 容灾重试超时或取消后等待各地域返回结果的最长时间
+	pendingResultWaitingTime = 100
 )
 
 type SecretManagerClient interface {
@@ -36,10 +39,18 @@ type SecretManagerClient interface {
 	// 获取指定凭据信息
 	GetSecretValue(req *kms.GetSecretValueRequest) (*kms.GetSecretValueResponse, error)
 
+	// 获取指定凭据信息，ctx取消或超时后停止等待与重试
+	GetSecretValueContext(ctx context.Context, req *kms.GetSecretValueRequest) (*kms.GetSecretValueResponse, error)
+
 	// 关闭Client
 	Close() error
 }
 
+// secretValueGetter 直接获取凭据的客户端，如专属KMS的KmsTransferClient
+type secretValueGetter interface {
+	GetSecretValue(request *kms.GetSecretValueRequest) (*kms.GetSecretValueResponse, error)
+}
+
 type baseSecretManagerClientBuilder struct {
 }
 
@@ -51,12 +62,36 @@ type defaultSecretManagerClientBuilder struct {
 	signer           auth.Signer
 	dKmsConfigsMap   map[*models.RegionInfo]*models.DkmsConfig
 	customConfigFile string
+	hedgeDelayMills  int64
+	// 熔断器连续失败阈值，为0时不开启熔断
+	circuitBreakerFailureThreshold int
+	circuitBreakerOpenTimeoutMills int64
+	regionProber                   RegionProber
+	// 后台重新排序地域的间隔，单位ms，为0时只在Init时排序
+	regionRankIntervalMills int64
+	// 重试预算令牌上限，为0时不限制重试
+	retryBudgetMaxTokens  int
+	retryBudgetTokenRatio float64
+	// 每秒请求数上限，为0时不限流
+	rateLimitQps   float64
+	rateLimitBurst int
 }
 
 type defaultSecretManagerClient struct {
 	*defaultSecretManagerClientBuilder
 	clientMap map[*models.RegionInfo]interface{}
-	clientMtx sync.Mutex
+	clientMtx sync.RWMutex
+	// Init后只读
+	circuitBreakers map[*models.RegionInfo]*regionCircuitBreaker
+	// Init后只读
+	regionStats map[*models.RegionInfo]*regionStats
+	// 后台重新排序后的地域顺序，类型为[]*models.RegionInfo
+	rankedRegionInfos atomic.Value
+	rankStop          chan struct{}
+	rankStopOnce      sync.Once
+	rankWg            sync.WaitGroup
+	retryBudget       *retryBudget
+	rateLimiter       *rateLimiter
 }
 
 func NewBaseSecretManagerClientBuilder() *baseSecretManagerClientBuilder {
@@ -125,6 +160,45 @@ func (dsb *defaultSecretManagerClientBuilder) WithCustomConfigFile(customConfigF
 	return dsb
 }
 
+// 开启对冲请求，首个地域在hedgeDelayMills毫秒内未返回时向下一个地域发起相同请求，取最先成功的结果
+func (dsb *defaultSecretManagerClientBuilder) WithHedgeDelay(hedgeDelayMills int64) *defaultSecretManagerClientBuilder {
+	dsb.hedgeDelayMills = hedgeDelayMills
+	return dsb
+}
+
+// 指定地域探测器，用于多地域按延迟排序，默认使用TlsRegionProber
+func (dsb *defaultSecretManagerClientBuilder) WithRegionProber(regionProber RegionProber) *defaultSecretManagerClientBuilder {
+	dsb.regionProber = regionProber
+	return dsb
+}
+
+// 开启后台地域重新排序，每隔intervalMills毫秒结合探测延迟及实际请求的延迟与错误率对地域重新排序
+func (dsb *defaultSecretManagerClientBuilder) WithRegionRankInterval(intervalMills int64) *defaultSecretManagerClientBuilder {
+	dsb.regionRankIntervalMills = intervalMills
+	return dsb
+}
+
+// 开启重试预算，所有地域的重试共享maxTokens个令牌，每次成功请求补充tokenRatio个令牌，预算耗尽时不再重试
+func (dsb *defaultSecretManagerClientBuilder) WithRetryBudget(maxTokens int, tokenRatio float64) *defaultSecretManagerClientBuilder {
+	dsb.retryBudgetMaxTokens = maxTokens
+	dsb.retryBudgetTokenRatio = tokenRatio
+	return dsb
+}
+
+// 限制发往KMS的请求速率，每秒最多qps个请求，允许burst个突发请求
+func (dsb *defaultSecretManagerClientBuilder) WithRateLimit(qps float64, burst int) *defaultSecretManagerClientBuilder {
+	dsb.rateLimitQps = qps
+	dsb.rateLimitBurst = burst
+	return dsb
+}
+
+// 开启地域熔断，连续failureThreshold次可容灾错误后跳过该地域，openTimeoutMills毫秒后放行探测请求
+func (dsb *defaultSecretManagerClientBuilder) WithCircuitBreaker(failureThreshold int, openTimeoutMills int64) *defaultSecretManagerClientBuilder {
+	dsb.circuitBreakerFailureThreshold = failureThreshold
+	dsb.circuitBreakerOpenTimeoutMills = openTimeoutMills
+	return dsb
+}
+
 func (dsb *defaultSecretManagerClientBuilder) Build() SecretManagerClient {
 	return &defaultSecretManagerClient{
 		defaultSecretManagerClientBuilder: dsb,
@@ -138,37 +212,41 @@ func (dsb *defaultSecretManagerClientBuilder) addRegion(regionId string) *defaul
 }
 
 func (dsb *defaultSecretManagerClientBuilder) sortRegionInfos(regionInfos []*models.RegionInfo) []*models.RegionInfo {
-	var regionInfoResp []*models.RegionInfo
-	var regionInfoExtends []*models.RegionInfoExtend
+	return sortRegionInfoExtends(dsb.probeRegionInfos(regionInfos))
+}
+
+// 并发探测各地域延迟，不可达地域的延迟为math.MaxFloat64
+func (dsb *defaultSecretManagerClientBuilder) probeRegionInfos(regionInfos []*models.RegionInfo) []*models.RegionInfoExtend {
+	// 每个goroutine只写入自己下标的元素，避免并发append
+	regionInfoExtends := make([]*models.RegionInfoExtend, len(regionInfos))
 	var wg sync.WaitGroup
-	for _, regionInfo := range regionInfos {
+	for i, regionInfo := range regionInfos {
 		wg.Add(1)
-		regionInfo := regionInfo
+		i, regionInfo := i, regionInfo
 		go func(wg *sync.WaitGroup) {
 			defer wg.Done()
-			var pingDelay float64
 			regionInfoExtend := &models.RegionInfoExtend{
 				RegionInfo: regionInfo,
 			}
-			if regionInfo.Endpoint != "" {
-				pingDelay = utils.Ping(regionInfo.Endpoint)
-			} else if regionInfo.Vpc {
-				pingDelay = utils.Ping(utils.GetVpcEndpoint(regionInfo.RegionId))
-			} else {
-				pingDelay = utils.Ping(utils.GetEndpoint(regionInfo.RegionId))
-			}
+			pingDelay := dsb.regionProber.Probe(regionInfo)
 			if pingDelay >= 0 {
 				regionInfoExtend.Escaped = pingDelay
 			} else {
 				regionInfoExtend.Escaped = math.MaxFloat64
 			}
 			regionInfoExtend.Reachable = pingDelay >= 0
-			regionInfoExtends = append(regionInfoExtends, regionInfoExtend)
+			regionInfoExtends[i] = regionInfoExtend
 		}(&wg)
 	}
 	wg.Wait()
+	return regionInfoExtends
+}
+
+// 按延迟从小到大排序，延迟相同时保持原有顺序
+func sortRegionInfoExtends(regionInfoExtends []*models.RegionInfoExtend) []*models.RegionInfo {
+	var regionInfoResp []*models.RegionInfo
 	// 注意>go1.8才有sort.Slice
-	sort.Slice(regionInfoExtends, func(i, j int) bool {
+	sort.SliceStable(regionInfoExtends, func(i, j int) bool {
 		return regionInfoExtends[i].Escaped < regionInfoExtends[j].Escaped
 	})
 	for _, regionInfoExtend := range regionInfoExtends {
@@ -187,10 +265,10 @@ func (dmc *defaultSecretManagerClient) Init() error {
 		return err
 	}
 	if len(dmc.regionInfos) == 0 {
-		return errors.New("the param[regionInfo] is needed")
+		return utils.NewConfigError("regionInfo", "the param[regionInfo] is needed", nil)
 	}
 	if len(dmc.dKmsConfigsMap) == 0 && dmc.credential == nil {
-		return errors.New("the param[credentials] is needed")
+		return utils.NewConfigError("credentials", "the param[credentials] is needed", nil)
 	}
 	credential, ok := dmc.credential.(*models.ClientKeyCredential)
 	if ok {
@@ -205,70 +283,334 @@ func (dmc *defaultSecretManagerClient) Init() error {
 	if err != nil {
 		return err
 	}
+	if dmc.regionProber == nil {
+		dmc.regionProber = &TlsRegionProber{}
+	}
+	err = dmc.regionProber.Init()
+	if err != nil {
+		return err
+	}
 	if dmc.regionInfos != nil && len(dmc.regionInfos) > 1 {
 		dmc.regionInfos = dmc.sortRegionInfos(dmc.regionInfos)
 	}
+	dmc.initCircuitBreakers()
+	dmc.initRequestLimiters()
+	dmc.startRegionRanking()
 	return nil
 }
 
+func (dmc *defaultSecretManagerClient) initRequestLimiters() {
+	if dmc.retryBudgetMaxTokens > 0 {
+		dmc.retryBudget = newRetryBudget(dmc.retryBudgetMaxTokens, dmc.retryBudgetTokenRatio)
+	}
+	if dmc.rateLimitQps > 0 {
+		dmc.rateLimiter = newRateLimiter(dmc.rateLimitQps, dmc.rateLimitBurst)
+	}
+}
+
+func (dmc *defaultSecretManagerClient) startRegionRanking() {
+	if dmc.regionRankIntervalMills <= 0 || len(dmc.regionInfos) <= 1 {
+		return
+	}
+	dmc.regionStats = make(map[*models.RegionInfo]*regionStats, len(dmc.regionInfos))
+	for _, regionInfo := range dmc.regionInfos {
+		dmc.regionStats[regionInfo] = &regionStats{}
+	}
+	dmc.rankStop = make(chan struct{})
+	dmc.rankWg.Add(1)
+	go func() {
+		defer dmc.rankWg.Done()
+		ticker := time.NewTicker(time.Duration(dmc.regionRankIntervalMills) * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-dmc.rankStop:
+				return
+			case <-ticker.C:
+				dmc.rankRegionInfos()
+			}
+		}
+	}()
+}
+
+func (dmc *defaultSecretManagerClient) stopRegionRanking() {
+	if dmc.rankStop == nil {
+		return
+	}
+	dmc.rankStopOnce.Do(func() {
+		close(dmc.rankStop)
+	})
+	dmc.rankWg.Wait()
+}
+
+// 重新探测所有地域，结合实际请求的平均延迟与错误率排序后原子替换地域顺序
+func (dmc *defaultSecretManagerClient) rankRegionInfos() {
+	regionInfoExtends := dmc.probeRegionInfos(dmc.regionInfos)
+	for _, regionInfoExtend := range regionInfoExtends {
+		rs, ok := dmc.regionStats[regionInfoExtend.RegionInfo]
+		if !ok {
+			continue
+		}
+		latencyMills, errorRate, ok := rs.snapshot()
+		if !ok {
+			continue
+		}
+		// 探测不可达时以实际请求延迟为准
+		if regionInfoExtend.Reachable {
+			regionInfoExtend.Escaped = (regionInfoExtend.Escaped + latencyMills) / 2
+		} else {
+			regionInfoExtend.Escaped = latencyMills
+			regionInfoExtend.Reachable = true
+		}
+		regionInfoExtend.Escaped *= 1 + regionErrorRatePenalty*errorRate
+	}
+	dmc.rankedRegionInfos.Store(sortRegionInfoExtends(regionInfoExtends))
+}
+
+func (dmc *defaultSecretManagerClient) initCircuitBreakers() {
+	if dmc.circuitBreakerFailureThreshold <= 0 {
+		return
+	}
+	dmc.circuitBreakers = make(map[*models.RegionInfo]*regionCircuitBreaker, len(dmc.regionInfos))
+	for _, regionInfo := range dmc.regionInfos {
+		dmc.circuitBreakers[regionInfo] = newRegionCircuitBreaker(dmc.circuitBreakerFailureThreshold, dmc.circuitBreakerOpenTimeoutMills)
+	}
+}
+
+// 获取各地域熔断器状态
+func (dmc *defaultSecretManagerClient) GetCircuitBreakerStates() []*RegionCircuitBreakerState {
+	var states []*RegionCircuitBreakerState
+	for _, regionInfo := range dmc.regionInfos {
+		if cb, ok := dmc.circuitBreakers[regionInfo]; ok {
+			states = append(states, cb.getState(regionInfo))
+		}
+	}
+	return states
+}
+
+// 获取调用地域顺序，熔断器打开的地域排在最后
+func (dmc *defaultSecretManagerClient) getRegionInfos() []*models.RegionInfo {
+	rankedRegionInfos := dmc.regionInfos
+	if ranked, ok := dmc.rankedRegionInfos.Load().([]*models.RegionInfo); ok {
+		rankedRegionInfos = ranked
+	}
+	if len(dmc.circuitBreakers) == 0 {
+		return rankedRegionInfos
+	}
+	regionInfos := make([]*models.RegionInfo, 0, len(rankedRegionInfos))
+	var openRegionInfos []*models.RegionInfo
+	for _, regionInfo := range rankedRegionInfos {
+		if cb, ok := dmc.circuitBreakers[regionInfo]; ok && !cb.available() {
+			openRegionInfos = append(openRegionInfos, regionInfo)
+		} else {
+			regionInfos = append(regionInfos, regionInfo)
+		}
+	}
+	return append(regionInfos, openRegionInfos...)
+}
+
 func (dmc *defaultSecretManagerClient) GetSecretValue(req *kms.GetSecretValueRequest) (*kms.GetSecretValueResponse, error) {
-	var results []*kms.GetSecretValueResponse
-	var errs []error
-	var wg sync.WaitGroup
-	finished := int32(len(dmc.regionInfos))
-	retryEnd := make(chan struct{})
-	for i, regionInfo := range dmc.regionInfos {
-		if i == 0 {
-			resp, err := dmc.getSecretValue(regionInfo, req)
-			if err == nil {
-				return resp, nil
+	return dmc.GetSecretValueContext(context.Background(), req)
+}
+
+func (dmc *defaultSecretManagerClient) GetSecretValueContext(ctx context.Context, req *kms.GetSecretValueRequest) (*kms.GetSecretValueResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if dmc.hedgeDelayMills > 0 && len(dmc.regionInfos) > 1 {
+		return dmc.hedgeGetSecretValue(ctx, req)
+	}
+	regionInfo := dmc.getRegionInfos()[0]
+	resp, err := dmc.getSecretValue(ctx, regionInfo, req)
+	if err == nil {
+		return resp, nil
+	}
+	logger.GetCommonLogger(utils.ModeName).Errorf("action:getSecretValue, regionInfo:%+v, %+v", regionInfo, err)
+	if !utils.JudgeNeedRecoveryException(err) {
+		return nil, err
+	}
+	return dmc.failoverGetSecretValue(ctx, req, []*utils.RegionError{{RegionInfo: regionInfo, Err: err}})
+}
+
+// 按地域顺序发起对冲请求，上一个地域超过对冲延迟未返回或返回可容灾错误时请求下一个地域，所有地域均失败后进入重试容灾
+func (dmc *defaultSecretManagerClient) hedgeGetSecretValue(ctx context.Context, req *kms.GetSecretValueRequest) (*kms.GetSecretValueResponse, error) {
+	regionInfos := dmc.getRegionInfos()
+	hedgeDelay := time.Duration(dmc.hedgeDelayMills) * time.Millisecond
+	// 返回时取消其余对冲请求的限流等待
+	hctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// kms sdk不支持取消进行中的请求，返回后未完成的请求结果写入缓冲区后直接丢弃
+	results := make(chan *regionResult, len(regionInfos))
+	launched, pending := 0, 0
+	launch := func() {
+		regionInfo := regionInfos[launched]
+		request := req
+		if launched > 0 {
+			request = newGetSecretValueRequest(req)
+		}
+		go func() {
+			resp, err := dmc.getSecretValue(hctx, regionInfo, request)
+			results <- &regionResult{regionInfo: regionInfo, resp: resp, err: err}
+		}()
+		launched++
+		pending++
+	}
+	launch()
+	timer := time.NewTimer(hedgeDelay)
+	defer timer.Stop()
+	var errs []*utils.RegionError
+	notRecoverable := false
+	for pending > 0 {
+		select {
+		case result := <-results:
+			pending--
+			if result.err == nil {
+				return result.resp, nil
 			}
-			logger.GetCommonLogger(utils.ModeName).Errorf("action:getSecretValue, regionInfo:%+v, %+v", regionInfo, err)
-			if !utils.JudgeNeedRecoveryException(err) {
-				return nil, err
+			logger.GetCommonLogger(utils.ModeName).Errorf("action:hedgeGetSecretValue, regionInfo:%+v, %+v", result.regionInfo, result.err)
+			// 只有首个地域返回不可容灾错误时直接返回，其余地域的错误记录后继续等待未完成的请求
+			if !utils.JudgeNeedRecoveryException(result.err) {
+				if result.regionInfo == regionInfos[0] {
+					return nil, result.err
+				}
+				notRecoverable = true
 			}
-			wg.Add(1)
-		}
-		regionInfo := regionInfo
-		// kms sdk判断domain为空以后通过region获取endpoint写到req结构domain字段里
-		// 后续domain有值以后sdk不再修改了，所以会导致所有region使用同一个endpoint
-		// 因此，要想访问不同的region，这里需要重新创建request
-		request := kms.CreateGetSecretValueRequest()
-		request.Scheme = "https"
-		request.SecretName = req.SecretName
-		request.VersionStage = req.VersionStage
-		request.FetchExtendedConfig = requests.NewBoolean(true)
-		go func(wg *sync.WaitGroup, finished *int32, retryEnd <-chan struct{}) {
-			if resp, err := dmc.retryGetSecretValue(request, regionInfo, retryEnd); err == nil {
-				results = append(results, resp)
-				wg.Done()
-			} else {
-				errs = append(errs, err)
-				for {
-					val := atomic.LoadInt32(finished)
-					if atomic.CompareAndSwapInt32(finished, val, val-1) {
-						break
+			errs = append(errs, &utils.RegionError{RegionInfo: result.regionInfo, Err: result.err})
+			// 地域请求失败时无需等待对冲延迟，立即请求下一个地域
+			if launched < len(regionInfos) {
+				launch()
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
 					}
 				}
-				if atomic.LoadInt32(finished) == 0 {
-					wg.Done()
+				timer.Reset(hedgeDelay)
+			}
+		case <-timer.C:
+			if launched < len(regionInfos) {
+				launch()
+				timer.Reset(hedgeDelay)
+			}
+		case <-ctx.Done():
+			return nil, wrapRegionErrors(ctx.Err(), errs)
+		}
+	}
+	// 存在不可容灾错误时不再进行容灾重试
+	if notRecoverable {
+		return nil, &utils.MultiRegionError{SecretName: req.SecretName, Errors: errs}
+	}
+	return dmc.failoverGetSecretValue(ctx, req, errs)
+}
+
+// regionResult 单个地域重试获取凭据的结果
+type regionResult struct {
+	regionInfo *models.RegionInfo
+	resp       *kms.GetSecretValueResponse
+	err        error
+}
+
+// 并发在所有地域重试获取凭据，返回第一个成功的结果，所有地域均失败时返回各地域的错误
+func (dmc *defaultSecretManagerClient) failoverGetSecretValue(ctx context.Context, req *kms.GetSecretValueRequest, errs []*utils.RegionError) (*kms.GetSecretValueResponse, error) {
+	retryCtx, cancel := context.WithTimeout(ctx, time.Duration(RequestWaitingTime)*time.Millisecond)
+	// 返回时取消其余地域的重试
+	defer cancel()
+	regionInfos := dmc.getRegionInfos()
+	// 缓冲区容纳所有地域的结果，提前返回后剩余goroutine也不会阻塞
+	results := make(chan *regionResult, len(regionInfos))
+	for _, regionInfo := range regionInfos {
+		request := newGetSecretValueRequest(req)
+		go func(regionInfo *models.RegionInfo) {
+			resp, err := dmc.retryGetSecretValue(retryCtx, request, regionInfo)
+			results <- &regionResult{regionInfo: regionInfo, resp: resp, err: err}
+		}(regionInfo)
+	}
+	pending := make(map[*models.RegionInfo]bool, len(regionInfos))
+	for _, regionInfo := range regionInfos {
+		pending[regionInfo] = true
+	}
+	for len(pending) > 0 {
+		select {
+		case result := <-results:
+			if result.err == nil {
+				return result.resp, nil
+			}
+			delete(pending, result.regionInfo)
+			errs = append(errs, &utils.RegionError{RegionInfo: result.regionInfo, Err: result.err})
+		case <-retryCtx.Done():
+			// 等待中的重试随retryCtx返回并携带各地域最后一次错误，进行中的请求无法取消，最多等待pendingResultWaitingTime
+			var resp *kms.GetSecretValueResponse
+			resp, errs = collectPendingResults(results, pending, errs)
+			if resp != nil {
+				return resp, nil
+			}
+			for _, regionInfo := range regionInfos {
+				if pending[regionInfo] {
+					errs = append(errs, &utils.RegionError{RegionInfo: regionInfo, Err: retryCtx.Err()})
 				}
 			}
-		}(&wg, &finished, retryEnd)
+			if err := ctx.Err(); err != nil {
+				return nil, wrapRegionErrors(err, errs)
+			}
+			return nil, &utils.MultiRegionError{SecretName: req.SecretName, Errors: errs}
+		}
 	}
-	dmc.waitTimeout(&wg, time.Duration(RequestWaitingTime)*time.Millisecond)
-	close(retryEnd)
-	if len(results) == 0 {
-		var errStr string
-		for _, err := range errs {
-			errStr += fmt.Sprintf("%+v;", err)
+	return nil, &utils.MultiRegionError{SecretName: req.SecretName, Errors: errs}
+}
+
+// 收集未完成地域的结果，已返回的地域从pending中移除，有地域成功时返回其结果
+func collectPendingResults(results chan *regionResult, pending map[*models.RegionInfo]bool, errs []*utils.RegionError) (*kms.GetSecretValueResponse, []*utils.RegionError) {
+	timer := time.NewTimer(pendingResultWaitingTime * time.Millisecond)
+	defer timer.Stop()
+	for len(pending) > 0 {
+		select {
+		case result := <-results:
+			if result.err == nil {
+				return result.resp, errs
+			}
+			delete(pending, result.regionInfo)
+			errs = append(errs, &utils.RegionError{RegionInfo: result.regionInfo, Err: result.err})
+		case <-timer.C:
+			return nil, errs
 		}
-		return nil, errors.New(fmt.Sprintf("action:retryGetSecretValueTask:%s", errStr))
 	}
-	return results[0], nil
+	return nil, errs
+}
+
+// 调用方取消或超时时保留已返回的各地域错误，errors.Is仍可判断ctx错误
+func wrapRegionErrors(err error, errs []*utils.RegionError) error {
+	if len(errs) == 0 {
+		return err
+	}
+	multiErrs := []error{err}
+	for _, regionErr := range errs {
+		multiErrs = append(multiErrs, regionErr)
+	}
+	return utils.NewMultiError(multiErrs...)
+}
+
+// kms sdk判断domain为空以后通过region获取endpoint写到req结构domain字段里
+// 后续domain有值以后sdk不再修改了，所以会导致所有region使用同一个endpoint
+// 因此，要想访问不同的region，这里需要重新创建request
+func newGetSecretValueRequest(req *kms.GetSecretValueRequest) *kms.GetSecretValueRequest {
+	request := kms.CreateGetSecretValueRequest()
+	request.Scheme = "https"
+	request.SecretName = req.SecretName
+	request.VersionId = req.VersionId
+	request.VersionStage = req.VersionStage
+	request.FetchExtendedConfig = requests.NewBoolean(true)
+	return request
+}
+
+// 获取WithCustomConfigFile指定的配置文件，未指定时为空
+func (dmc *defaultSecretManagerClient) GetCustomConfigFile() string {
+	return dmc.customConfigFile
 }
 
 func (dmc *defaultSecretManagerClient) Close() error {
+	dmc.stopRegionRanking()
+	dmc.clientMtx.RLock()
+	defer dmc.clientMtx.RUnlock()
 	for _, client := range dmc.clientMap {
 		switch c := client.(type) {
 		case *kms.Client:
@@ -280,24 +622,73 @@ func (dmc *defaultSecretManagerClient) Close() error {
 	return nil
 }
 
-func (dmc *defaultSecretManagerClient) getSecretValue(regionInfo *models.RegionInfo, req *kms.GetSecretValueRequest) (*kms.GetSecretValueResponse, error) {
+func (dmc *defaultSecretManagerClient) getSecretValue(ctx context.Context, regionInfo *models.RegionInfo, req *kms.GetSecretValueRequest) (*kms.GetSecretValueResponse, error) {
+	var resp *kms.GetSecretValueResponse
+	err := dmc.callRegion(ctx, regionInfo, func() error {
+		var err error
+		resp, err = dmc.doGetSecretValue(regionInfo, req)
+		return err
+	})
+	return resp, err
+}
+
+// 对单个地域发起调用，依次经过限流、熔断判断，并记录调用结果
+func (dmc *defaultSecretManagerClient) callRegion(ctx context.Context, regionInfo *models.RegionInfo, call func() error) error {
+	if dmc.rateLimiter != nil {
+		if err := dmc.rateLimiter.wait(ctx); err != nil {
+			return err
+		}
+	}
+	cb := dmc.circuitBreakers[regionInfo]
+	if cb != nil && !cb.tryAcquire() {
+		return fmt.Errorf("regionId:%s, %w", regionInfo.RegionId, utils.ErrCircuitOpen)
+	}
+	start := time.Now()
+	err := call()
+	// 仅可容灾错误计入地域失败，凭据不存在等业务错误说明地域可用
+	failed := err != nil && utils.JudgeNeedRecoveryException(err)
+	if cb != nil {
+		if failed {
+			cb.recordFailure()
+		} else {
+			cb.recordSuccess()
+		}
+	}
+	if !failed && dmc.retryBudget != nil {
+		dmc.retryBudget.recordSuccess()
+	}
+	if rs, ok := dmc.regionStats[regionInfo]; ok {
+		rs.record(float64(time.Since(start))/float64(time.Millisecond), failed)
+	}
+	return err
+}
+
+func (dmc *defaultSecretManagerClient) doGetSecretValue(regionInfo *models.RegionInfo, req *kms.GetSecretValueRequest) (*kms.GetSecretValueResponse, error) {
 	client, err := dmc.getClient(regionInfo)
 	if err != nil {
 		return nil, err
 	}
+	var response *kms.GetSecretValueResponse
 	switch c := client.(type) {
 	case *kms.Client:
-		response := kms.CreateGetSecretValueResponse()
-		return response, utils.TransferErrorToClientError(c.DoActionWithSigner(req, response, dmc.signer))
-	case *transfersdk.KmsTransferClient:
-		response, err := c.GetSecretValue(req)
-		return response, utils.TransferErrorToClientError(err)
+		response = kms.CreateGetSecretValueResponse()
+		err = c.DoActionWithSigner(req, response, dmc.signer)
+	case secretValueGetter:
+		response, err = c.GetSecretValue(req)
+	default:
+		return nil, errors.New("getClient unknown kms client type")
+	}
+	if err != nil {
+		return nil, utils.NewKmsError(req.SecretName, regionInfo, utils.TransferErrorToClientError(err))
 	}
-	return nil, errors.New("getClient unknown kms client type")
+	return response, nil
 }
 
 func (dmc *defaultSecretManagerClient) getClient(regionInfo *models.RegionInfo) (interface{}, error) {
-	if client, ok := dmc.clientMap[regionInfo]; ok {
+	dmc.clientMtx.RLock()
+	client, ok := dmc.clientMap[regionInfo]
+	dmc.clientMtx.RUnlock()
+	if ok {
 		return client, nil
 	}
 	dmc.clientMtx.Lock()
@@ -466,7 +857,7 @@ func (dmc *defaultSecretManagerClient) initCredentialFromEnv() error {
 		}
 		dmc.credential = models.NewClientKeyCredential(signer, credential)
 	default:
-		return errors.New(fmt.Sprintf("env param[%s] is illegal", utils.EnvCredentialsTypeKey))
+		return utils.NewConfigError(utils.EnvCredentialsTypeKey, fmt.Sprintf("env param[%s] is illegal", utils.EnvCredentialsTypeKey), nil)
 	}
 	return nil
 }
@@ -479,7 +870,7 @@ func (dmc *defaultSecretManagerClient) initKmsRegionsFromEnv() error {
 	var regionInfos []map[string]interface{}
 	err := json.Unmarshal([]byte(regionInfosJson), &regionInfos)
 	if err != nil {
-		return errors.New(fmt.Sprintf("env param[%s] is illegal, err: %v", utils.EnvCacheClientRegionIdKey, err))
+		return utils.NewConfigError(utils.EnvCacheClientRegionIdKey, fmt.Sprintf("env param[%s] is illegal, err: %v", utils.EnvCacheClientRegionIdKey, err), err)
 	}
 	for _, regionInfoMap := range regionInfos {
 		regionId, err := utils.ParseString(regionInfoMap[utils.EnvRegionRegionIdNameKey])
@@ -512,11 +903,11 @@ func (dmc *defaultSecretManagerClient) initDkmsInstancesFromEnv() error {
 	var dkmsConfigs []*models.DkmsConfig
 	err := json.Unmarshal([]byte(configJson), &dkmsConfigs)
 	if err != nil {
-		return errors.New(fmt.Sprintf("env param[%s] is illegal, err:%v", utils.CacheClientDkmsConfigInfoKey, err))
+		return utils.NewConfigError(utils.CacheClientDkmsConfigInfoKey, fmt.Sprintf("env param[%s] is illegal, err:%v", utils.CacheClientDkmsConfigInfoKey, err), err)
 	}
 	for _, dkmsConfig := range dkmsConfigs {
 		if tea.StringValue(dkmsConfig.RegionId) == "" || tea.StringValue(dkmsConfig.Endpoint) == "" || tea.StringValue(dkmsConfig.ClientKeyFile) == "" {
-			return errors.New("init env fail,cause of cache_client_dkms_config_info param[regionId or endpoint or clientKeyFile] is empty")
+			return utils.NewConfigError(utils.CacheClientDkmsConfigInfoKey, "init env fail,cause of cache_client_dkms_config_info param[regionId or endpoint or clientKeyFile] is empty", nil)
 		}
 		var password string
 		if dkmsConfig.PasswordFromFilePath != "" {
@@ -542,48 +933,63 @@ func (dmc *defaultSecretManagerClient) initDkmsInstancesFromEnv() error {
 
 func (dmc *defaultSecretManagerClient) checkEnvParam(param, paramName string) error {
 	if param == "" {
-		return errors.New(fmt.Sprintf("env param[%s] is required", paramName))
+		return utils.NewConfigError(paramName, fmt.Sprintf("env param[%s] is required", paramName), nil)
+	}
+	return nil
+}
+
+// 熔断打开的地域直接返回，不再等待退避及消耗重试预算
+func (dmc *defaultSecretManagerClient) checkCircuitBreaker(regionInfo *models.RegionInfo) error {
+	if cb := dmc.circuitBreakers[regionInfo]; cb != nil && !cb.available() {
+		return fmt.Errorf("action:retryGetSecretValue, regionId:%s, %w", regionInfo.RegionId, utils.ErrCircuitOpen)
 	}
 	return nil
 }
 
-func (dmc *defaultSecretManagerClient) retryGetSecretValue(req *kms.GetSecretValueRequest, regionInfo *models.RegionInfo, retryEnd <-chan struct{}) (*kms.GetSecretValueResponse, error) {
+func (dmc *defaultSecretManagerClient) retryGetSecretValue(ctx context.Context, req *kms.GetSecretValueRequest, regionInfo *models.RegionInfo) (*kms.GetSecretValueResponse, error) {
 	retryTimes := 0
+	var lastErr error
+	// 每次重试过程使用新的重试序列，去相关抖动等策略的等待时间依赖本次重试的上一次等待时间
+	backoffSequence := newBackoffSequence(dmc.backoffStrategy)
 	for {
-		select {
-		case <-retryEnd:
-			return nil, errors.New(fmt.Sprintf("action:retryGetSecretValue, retry end"))
-		default:
-			waitTimeExponential := dmc.backoffStrategy.GetWaitTimeExponential(retryTimes)
-			if waitTimeExponential < 0 {
-				return nil, errors.New(fmt.Sprintf("action:retryGetSecretValue, Times limit exceeded"))
+		waitTimeExponential := backoffSequence.NextWaitTime(retryTimes)
+		if waitTimeExponential < 0 {
+			if lastErr != nil {
+				return nil, fmt.Errorf("action:retryGetSecretValue, regionId:%s, Times limit exceeded, %w", regionInfo.RegionId, lastErr)
 			}
+			return nil, errors.New(fmt.Sprintf("action:retryGetSecretValue, Times limit exceeded"))
+		}
 
-			time.Sleep(time.Duration(waitTimeExponential) * time.Millisecond)
-
-			resp, err := dmc.getSecretValue(regionInfo, req)
-			if err == nil {
-				return resp, nil
-			}
-			logger.GetCommonLogger(utils.ModeName).Errorf("action:retryGetSecretValue, regionInfo:%+v, %+v", regionInfo, err)
-			if !utils.JudgeNeedRecoveryException(err) {
-				return nil, err
+		if err := dmc.checkCircuitBreaker(regionInfo); err != nil {
+			return nil, err
+		}
+		timer := time.NewTimer(time.Duration(waitTimeExponential) * time.Millisecond)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			// 保留最后一次调用的错误，errors.Is仍可判断ctx错误
+			if lastErr != nil {
+				return nil, utils.NewMultiError(ctx.Err(), lastErr)
 			}
-			retryTimes += 1
+			return nil, ctx.Err()
+		case <-timer.C:
 		}
-	}
-}
 
-func (dmc *defaultSecretManagerClient) waitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
-	done := make(chan struct{})
-	go func() {
-		defer close(done)
-		wg.Wait()
-	}()
-	select {
-	case <-done:
-		return false
-	case <-time.After(timeout):
-		return true
+		if err := dmc.checkCircuitBreaker(regionInfo); err != nil {
+			return nil, err
+		}
+		if dmc.retryBudget != nil && !dmc.retryBudget.tryAcquire() {
+			return nil, fmt.Errorf("action:retryGetSecretValue, regionId:%s, %w", regionInfo.RegionId, utils.ErrRetryBudgetExhausted)
+		}
+		resp, err := dmc.getSecretValue(ctx, regionInfo, req)
+		if err == nil {
+			return resp, nil
+		}
+		logger.GetCommonLogger(utils.ModeName).Errorf("action:retryGetSecretValue, regionInfo:%+v, %+v", regionInfo, err)
+		if !utils.JudgeNeedRecoveryException(err) || errors.Is(err, utils.ErrCircuitOpen) {
+			return nil, err
+		}
+		lastErr = err
+		retryTimes += 1
 	}
 }
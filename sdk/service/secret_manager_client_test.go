@@ -1,14 +1,20 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"os"
 	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/models"
 	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/utils"
 
 	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/auth/credentials"
+	sdkerr "github.com/aliyun/alibaba-cloud-sdk-go/sdk/errors"
 	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
 	"github.com/aliyun/alibaba-cloud-sdk-go/services/kms"
 	"github.com/stretchr/testify/assert"
@@ -88,3 +94,445 @@ func TestDefaultSecretManagerClient_GetSecretValue(t *testing.T) {
 		assert.NotNil(t, value)
 	}
 }
+
+func TestDefaultSecretManagerClient_RetryGetSecretValueContext(t *testing.T) {
+	builder := NewDefaultSecretManagerClientBuilder()
+	builder.WithRegion("cn-hangzhou")
+	builder.WithBackoffStrategy(NewFullJitterBackoffStrategyWithRandomSource(3, 60000, 60000, maxRandomSource{}))
+	client := builder.Build().(*defaultSecretManagerClient)
+	assert.Nil(t, client.backoffStrategy.Init())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := client.retryGetSecretValue(ctx, kms.CreateGetSecretValueRequest(), client.regionInfos[0])
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(start) < 10*time.Second)
+}
+
+type fakeRegionClient struct {
+	calls int32
+	fn    func(req *kms.GetSecretValueRequest) (*kms.GetSecretValueResponse, error)
+}
+
+func (f *fakeRegionClient) GetSecretValue(req *kms.GetSecretValueRequest) (*kms.GetSecretValueResponse, error) {
+	atomic.AddInt32(&f.calls, 1)
+	return f.fn(req)
+}
+
+func newFakeRegionClient(regionId string, err error) *fakeRegionClient {
+	return &fakeRegionClient{fn: func(req *kms.GetSecretValueRequest) (*kms.GetSecretValueResponse, error) {
+		if err != nil {
+			return nil, err
+		}
+		resp := kms.CreateGetSecretValueResponse()
+		resp.SecretName = req.SecretName
+		resp.RequestId = regionId
+		return resp, nil
+	}}
+}
+
+func newFailoverTestClient(t *testing.T, fakes map[string]*fakeRegionClient, regionIds ...string) *defaultSecretManagerClient {
+	builder := NewDefaultSecretManagerClientBuilder()
+	builder.WithRegion(regionIds...)
+	builder.WithBackoffStrategy(&FullJitterBackoffStrategy{RetryMaxAttempts: 2, RetryInitialIntervalMills: 1, Capacity: 5})
+	client := builder.Build().(*defaultSecretManagerClient)
+	assert.Nil(t, client.backoffStrategy.Init())
+	for _, regionInfo := range client.regionInfos {
+		client.clientMap[regionInfo] = fakes[regionInfo.RegionId]
+	}
+	return client
+}
+
+func TestDefaultSecretManagerClient_FailoverFirstSuccess(t *testing.T) {
+	unavailable := sdkerr.NewServerError(503, `{"Code":"ServiceUnavailableTemporary"}`, "")
+	fakes := map[string]*fakeRegionClient{
+		"region-a": newFakeRegionClient("region-a", unavailable),
+		"region-b": newFakeRegionClient("region-b", nil),
+		"region-c": newFakeRegionClient("region-c", unavailable),
+	}
+	client := newFailoverTestClient(t, fakes, "region-a", "region-b", "region-c")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			request := kms.CreateGetSecretValueRequest()
+			request.SecretName = "secret"
+			resp, err := client.GetSecretValue(request)
+			assert.Nil(t, err)
+			if assert.NotNil(t, resp) {
+				assert.Equal(t, "region-b", resp.RequestId)
+				assert.Equal(t, "secret", resp.SecretName)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Nil(t, client.Close())
+}
+
+func TestDefaultSecretManagerClient_FailoverAllRegionsFailed(t *testing.T) {
+	unavailable := sdkerr.NewServerError(503, `{"Code":"ServiceUnavailableTemporary"}`, "")
+	fakes := map[string]*fakeRegionClient{
+		"region-a": newFakeRegionClient("region-a", unavailable),
+		"region-b": newFakeRegionClient("region-b", unavailable),
+	}
+	client := newFailoverTestClient(t, fakes, "region-a", "region-b")
+
+	request := kms.CreateGetSecretValueRequest()
+	request.SecretName = "secret"
+	_, err := client.GetSecretValue(request)
+	assert.True(t, errors.Is(err, utils.ErrAllRegionsFailed))
+	assert.True(t, errors.Is(err, utils.ErrServiceUnavailable))
+	var multiErr *utils.MultiRegionError
+	if assert.True(t, errors.As(err, &multiErr)) {
+		assert.Equal(t, "secret", multiErr.SecretName)
+		assert.Equal(t, 3, len(multiErr.Errors))
+		// 重试次数用尽时保留最后一次的错误
+		for _, regionErr := range multiErr.Errors {
+			assert.True(t, errors.Is(regionErr, utils.ErrServiceUnavailable))
+		}
+	}
+}
+
+func TestDefaultSecretManagerClient_FailoverNotRecoverable(t *testing.T) {
+	notFound := sdkerr.NewServerError(404, `{"Code":"Forbidden.ResourceNotFound"}`, "")
+	fakes := map[string]*fakeRegionClient{
+		"region-a": newFakeRegionClient("region-a", notFound),
+		"region-b": newFakeRegionClient("region-b", nil),
+	}
+	client := newFailoverTestClient(t, fakes, "region-a", "region-b")
+
+	request := kms.CreateGetSecretValueRequest()
+	request.SecretName = "secret"
+	_, err := client.GetSecretValue(request)
+	assert.True(t, errors.Is(err, utils.ErrSecretNotFound))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fakes["region-a"].calls))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&fakes["region-b"].calls))
+}
+
+// 首次重试不等待，之后等待较长时间，用于验证等待期间取消时保留最后一次错误
+type firstRetryBackoffStrategy struct{}
+
+func (firstRetryBackoffStrategy) Init() error {
+	return nil
+}
+
+func (firstRetryBackoffStrategy) GetWaitTimeExponential(retryTimes int) int64 {
+	if retryTimes == 0 {
+		return 0
+	}
+	return 60000
+}
+
+func TestDefaultSecretManagerClient_RetryGetSecretValueLastErr(t *testing.T) {
+	unavailable := sdkerr.NewServerError(503, `{"Code":"ServiceUnavailableTemporary"}`, "")
+	fakes := map[string]*fakeRegionClient{
+		"region-a": newFakeRegionClient("region-a", unavailable),
+	}
+	client := newFailoverTestClient(t, fakes, "region-a")
+	client.backoffStrategy = firstRetryBackoffStrategy{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := client.retryGetSecretValue(ctx, kms.CreateGetSecretValueRequest(), client.regionInfos[0])
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.True(t, errors.Is(err, utils.ErrServiceUnavailable))
+}
+
+func TestDefaultSecretManagerClient_FailoverContextCanceled(t *testing.T) {
+	unavailable := sdkerr.NewServerError(503, `{"Code":"ServiceUnavailableTemporary"}`, "")
+	fakes := map[string]*fakeRegionClient{
+		"region-a": newFakeRegionClient("region-a", unavailable),
+		"region-b": newFakeRegionClient("region-b", unavailable),
+	}
+	client := newFailoverTestClient(t, fakes, "region-a", "region-b")
+	client.backoffStrategy = firstRetryBackoffStrategy{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	request := kms.CreateGetSecretValueRequest()
+	request.SecretName = "secret"
+	_, err := client.GetSecretValueContext(ctx, request)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	// 保留首次调用返回的地域错误
+	var regionErr *utils.RegionError
+	if assert.True(t, errors.As(err, &regionErr)) {
+		assert.Equal(t, "region-a", regionErr.RegionInfo.RegionId)
+		assert.True(t, errors.Is(regionErr, utils.ErrServiceUnavailable))
+	}
+	// 容灾重试阶段各地域的错误保留最后一次调用的错误
+	var multiErr *utils.MultiError
+	if assert.True(t, errors.As(err, &multiErr)) {
+		// ctx错误、首次调用错误及容灾重试阶段2个地域的错误
+		assert.Equal(t, 4, len(multiErr.Errors))
+		for _, e := range multiErr.Errors[2:] {
+			assert.True(t, errors.Is(e, context.DeadlineExceeded))
+			assert.True(t, errors.Is(e, utils.ErrServiceUnavailable))
+		}
+	}
+}
+
+func TestDefaultSecretManagerClient_HedgeSlowPrimary(t *testing.T) {
+	slow := newFakeRegionClient("region-a", nil)
+	fn := slow.fn
+	slow.fn = func(req *kms.GetSecretValueRequest) (*kms.GetSecretValueResponse, error) {
+		time.Sleep(500 * time.Millisecond)
+		return fn(req)
+	}
+	fakes := map[string]*fakeRegionClient{
+		"region-a": slow,
+		"region-b": newFakeRegionClient("region-b", nil),
+	}
+	client := newFailoverTestClient(t, fakes, "region-a", "region-b")
+	client.hedgeDelayMills = 20
+
+	request := kms.CreateGetSecretValueRequest()
+	request.SecretName = "secret"
+	start := time.Now()
+	resp, err := client.GetSecretValue(request)
+	assert.Nil(t, err)
+	assert.Equal(t, "region-b", resp.RequestId)
+	assert.True(t, time.Since(start) < 400*time.Millisecond)
+}
+
+func TestDefaultSecretManagerClient_HedgeRecoverableError(t *testing.T) {
+	unavailable := sdkerr.NewServerError(503, `{"Code":"ServiceUnavailableTemporary"}`, "")
+	fakes := map[string]*fakeRegionClient{
+		"region-a": newFakeRegionClient("region-a", unavailable),
+		"region-b": newFakeRegionClient("region-b", nil),
+	}
+	client := newFailoverTestClient(t, fakes, "region-a", "region-b")
+	client.hedgeDelayMills = 60000
+
+	request := kms.CreateGetSecretValueRequest()
+	request.SecretName = "secret"
+	start := time.Now()
+	resp, err := client.GetSecretValue(request)
+	assert.Nil(t, err)
+	assert.Equal(t, "region-b", resp.RequestId)
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestDefaultSecretManagerClient_HedgeSecondaryNotRecoverable(t *testing.T) {
+	slow := newFakeRegionClient("region-a", nil)
+	fn := slow.fn
+	slow.fn = func(req *kms.GetSecretValueRequest) (*kms.GetSecretValueResponse, error) {
+		time.Sleep(200 * time.Millisecond)
+		return fn(req)
+	}
+	notFound := sdkerr.NewServerError(404, `{"Code":"Forbidden.ResourceNotFound"}`, "")
+	fakes := map[string]*fakeRegionClient{
+		"region-a": slow,
+		"region-b": newFakeRegionClient("region-b", notFound),
+	}
+	client := newFailoverTestClient(t, fakes, "region-a", "region-b")
+	client.hedgeDelayMills = 20
+
+	// 对冲地域返回不可容灾错误时继续等待首个地域的结果
+	request := kms.CreateGetSecretValueRequest()
+	request.SecretName = "secret"
+	resp, err := client.GetSecretValue(request)
+	assert.Nil(t, err)
+	assert.Equal(t, "region-a", resp.RequestId)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fakes["region-b"].calls))
+
+	// 所有地域均失败且包含不可容灾错误时不再进行容灾重试
+	unavailable := sdkerr.NewServerError(503, `{"Code":"ServiceUnavailableTemporary"}`, "")
+	fakes["region-a"] = newFakeRegionClient("region-a", unavailable)
+	fakes["region-b"] = newFakeRegionClient("region-b", notFound)
+	client = newFailoverTestClient(t, fakes, "region-a", "region-b")
+	client.hedgeDelayMills = 20
+	_, err = client.GetSecretValue(request)
+	var multiErr *utils.MultiRegionError
+	if assert.True(t, errors.As(err, &multiErr)) {
+		assert.Equal(t, 2, len(multiErr.Errors))
+	}
+	assert.True(t, utils.JudgeErrorCode(err, "Forbidden.ResourceNotFound"))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fakes["region-a"].calls))
+}
+
+func TestDefaultSecretManagerClient_HedgeAllRegionsFailed(t *testing.T) {
+	unavailable := sdkerr.NewServerError(503, `{"Code":"ServiceUnavailableTemporary"}`, "")
+	fakes := map[string]*fakeRegionClient{
+		"region-a": newFakeRegionClient("region-a", unavailable),
+		"region-b": newFakeRegionClient("region-b", unavailable),
+	}
+	client := newFailoverTestClient(t, fakes, "region-a", "region-b")
+	client.hedgeDelayMills = 20
+
+	request := kms.CreateGetSecretValueRequest()
+	request.SecretName = "secret"
+	_, err := client.GetSecretValue(request)
+	var multiErr *utils.MultiRegionError
+	if assert.True(t, errors.As(err, &multiErr)) {
+		// 对冲阶段2个地域的错误，加上重试容灾阶段2个地域的错误
+		assert.Equal(t, 4, len(multiErr.Errors))
+	}
+}
+
+func TestDefaultSecretManagerClient_HedgeCancelPending(t *testing.T) {
+	slow := newFakeRegionClient("region-a", nil)
+	fn := slow.fn
+	slow.fn = func(req *kms.GetSecretValueRequest) (*kms.GetSecretValueResponse, error) {
+		time.Sleep(100 * time.Millisecond)
+		return fn(req)
+	}
+	fakes := map[string]*fakeRegionClient{
+		"region-a": slow,
+		"region-b": newFakeRegionClient("region-b", nil),
+	}
+	client := newFailoverTestClient(t, fakes, "region-a", "region-b")
+	client.hedgeDelayMills = 20
+	client.rateLimitQps = 2
+	client.rateLimitBurst = 1
+	client.initRequestLimiters()
+
+	request := kms.CreateGetSecretValueRequest()
+	request.SecretName = "secret"
+	resp, err := client.GetSecretValue(request)
+	assert.Nil(t, err)
+	assert.Equal(t, "region-a", resp.RequestId)
+	// 返回后等待限流的对冲请求被取消，不再发起调用
+	time.Sleep(600 * time.Millisecond)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&fakes["region-b"].calls))
+}
+
+func TestDefaultSecretManagerClient_CircuitBreaker(t *testing.T) {
+	unavailable := sdkerr.NewServerError(503, `{"Code":"ServiceUnavailableTemporary"}`, "")
+	fakes := map[string]*fakeRegionClient{
+		"region-a": newFakeRegionClient("region-a", unavailable),
+		"region-b": newFakeRegionClient("region-b", nil),
+	}
+	client := newFailoverTestClient(t, fakes, "region-a", "region-b")
+	client.circuitBreakerFailureThreshold = 2
+	client.circuitBreakerOpenTimeoutMills = 60000
+	client.initCircuitBreakers()
+
+	for i := 0; i < 5; i++ {
+		request := kms.CreateGetSecretValueRequest()
+		request.SecretName = "secret"
+		resp, err := client.GetSecretValue(request)
+		assert.Nil(t, err)
+		assert.Equal(t, "region-b", resp.RequestId)
+	}
+	// 熔断打开后不再请求region-a
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fakes["region-a"].calls))
+	assert.Equal(t, "region-b", client.getRegionInfos()[0].RegionId)
+
+	var provider CircuitBreakerStatsProvider = client
+	states := provider.GetCircuitBreakerStates()
+	assert.Equal(t, 2, len(states))
+	assert.Equal(t, "region-a", states[0].RegionInfo.RegionId)
+	assert.Equal(t, CircuitBreakerOpen, states[0].State)
+	assert.Equal(t, CircuitBreakerClosed, states[1].State)
+}
+
+func TestDefaultSecretManagerClient_CircuitOpenSkipRetry(t *testing.T) {
+	unavailable := sdkerr.NewServerError(503, `{"Code":"ServiceUnavailableTemporary"}`, "")
+	fakes := map[string]*fakeRegionClient{
+		"region-a": newFakeRegionClient("region-a", unavailable),
+	}
+	client := newFailoverTestClient(t, fakes, "region-a")
+	client.backoffStrategy = &FullJitterBackoffStrategy{RetryMaxAttempts: 3, RetryInitialIntervalMills: 60000, Capacity: 60000}
+	assert.Nil(t, client.backoffStrategy.Init())
+	client.circuitBreakerFailureThreshold = 1
+	client.circuitBreakerOpenTimeoutMills = 60000
+	client.initCircuitBreakers()
+	client.retryBudget = newRetryBudget(10, 0.1)
+
+	// 熔断打开后重试容灾直接返回，不等待退避也不消耗重试预算
+	request := kms.CreateGetSecretValueRequest()
+	request.SecretName = "secret"
+	start := time.Now()
+	_, err := client.GetSecretValue(request)
+	assert.True(t, errors.Is(err, utils.ErrCircuitOpen))
+	assert.True(t, time.Since(start) < time.Second)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fakes["region-a"].calls))
+	assert.Equal(t, float64(10), client.retryBudget.tokens)
+}
+
+func TestDefaultSecretManagerClient_RankRegionInfos(t *testing.T) {
+	unavailable := sdkerr.NewServerError(503, `{"Code":"ServiceUnavailableTemporary"}`, "")
+	fakes := map[string]*fakeRegionClient{
+		"region-a": newFakeRegionClient("region-a", unavailable),
+		"region-b": newFakeRegionClient("region-b", nil),
+	}
+	client := newFailoverTestClient(t, fakes, "region-a", "region-b")
+	// 探测延迟region-a更低，但实际请求持续失败
+	client.regionProber = fakeRegionProber{"region-a": 10, "region-b": 20}
+	client.regionRankIntervalMills = 10
+	client.startRegionRanking()
+	defer client.Close()
+
+	client.rankRegionInfos()
+	assert.Equal(t, "region-a", client.getRegionInfos()[0].RegionId)
+
+	for i := 0; i < 5; i++ {
+		request := kms.CreateGetSecretValueRequest()
+		request.SecretName = "secret"
+		_, err := client.GetSecretValue(request)
+		assert.Nil(t, err)
+	}
+	client.rankRegionInfos()
+	assert.Equal(t, "region-b", client.getRegionInfos()[0].RegionId)
+	assert.Equal(t, "region-a", client.regionInfos[0].RegionId)
+}
+
+func TestDefaultSecretManagerClient_RegionRankingLoop(t *testing.T) {
+	fakes := map[string]*fakeRegionClient{
+		"region-a": newFakeRegionClient("region-a", nil),
+		"region-b": newFakeRegionClient("region-b", nil),
+	}
+	client := newFailoverTestClient(t, fakes, "region-a", "region-b")
+	client.regionProber = fakeRegionProber{"region-a": -1, "region-b": 20}
+	client.regionRankIntervalMills = 10
+	client.startRegionRanking()
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, "region-b", client.getRegionInfos()[0].RegionId)
+	assert.Nil(t, client.Close())
+	// 重复关闭不会阻塞
+	assert.Nil(t, client.Close())
+}
+
+func TestDefaultSecretManagerClient_RetryBudget(t *testing.T) {
+	unavailable := sdkerr.NewServerError(503, `{"Code":"ServiceUnavailableTemporary"}`, "")
+	fakes := map[string]*fakeRegionClient{
+		"region-a": newFakeRegionClient("region-a", unavailable),
+		"region-b": newFakeRegionClient("region-b", unavailable),
+	}
+	client := newFailoverTestClient(t, fakes, "region-a", "region-b")
+	client.retryBudgetMaxTokens = 1
+	client.initRequestLimiters()
+
+	request := kms.CreateGetSecretValueRequest()
+	request.SecretName = "secret"
+	_, err := client.GetSecretValue(request)
+	assert.True(t, errors.Is(err, utils.ErrRetryBudgetExhausted))
+	assert.True(t, errors.Is(err, utils.ErrAllRegionsFailed))
+	// 首次请求加上预算内的1次重试
+	calls := atomic.LoadInt32(&fakes["region-a"].calls) + atomic.LoadInt32(&fakes["region-b"].calls)
+	assert.Equal(t, int32(2), calls)
+}
+
+func TestDefaultSecretManagerClient_RateLimit(t *testing.T) {
+	fakes := map[string]*fakeRegionClient{
+		"region-a": newFakeRegionClient("region-a", nil),
+	}
+	client := newFailoverTestClient(t, fakes, "region-a")
+	client.rateLimitQps = 1
+	client.rateLimitBurst = 1
+	client.initRequestLimiters()
+
+	request := kms.CreateGetSecretValueRequest()
+	request.SecretName = "secret"
+	_, err := client.GetSecretValue(request)
+	assert.Nil(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = client.GetSecretValueContext(ctx, request)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fakes["region-a"].calls))
+}
@@ -5,6 +5,8 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/sha256"
+	"errors"
+	"fmt"
 
 	"golang.org/x/crypto/pbkdf2"
 )
@@ -13,6 +15,10 @@ const (
 	IterationCount   = 1000
 	KeyLength        = 32
 	Aes256CbcModeKey = "001"
+	// aes256-gcm加密，数据密钥由CacheKeyProvider包装后存储
+	Aes256GcmEnvelopeModeKey = "003"
+	// GCM随机数字节长度
+	GcmNonceLength = 12
 )
 
 // EncryptAes256Cbc 加密data，使用aes256-cbc算法，填充方式为pkcs5,
@@ -38,10 +44,59 @@ func DecryptAes256Cbc(data, secret, iv, salt []byte) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	if len(iv) != block.BlockSize() {
+		return "", errors.New(fmt.Sprintf("invalid iv length:%d", len(iv)))
+	}
+	if len(data) == 0 || len(data)%block.BlockSize() != 0 {
+		return "", errors.New(fmt.Sprintf("invalid cipher data length:%d", len(data)))
+	}
 	cbc := cipher.NewCBCDecrypter(block, iv)
 	cipherText := make([]byte, len(data))
 	cbc.CryptBlocks(cipherText, data)
-	return string(pkcs5UnPadding(cipherText)), nil
+	plainText, err := pkcs5UnPadding(cipherText, block.BlockSize())
+	if err != nil {
+		return "", err
+	}
+	return string(plainText), nil
+}
+
+// EncryptAes256Gcm 加密data，使用aes256-gcm算法，additionalData参与认证但不加密,
+// aes密钥通过pbkdf2-hmac-sha256算法派生
+func EncryptAes256Gcm(data, secret, nonce, salt, additionalData []byte) ([]byte, error) {
+	gcm, err := newAes256Gcm(secret, salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, errors.New(fmt.Sprintf("invalid nonce length:%d", len(nonce)))
+	}
+	return gcm.Seal(nil, nonce, data, additionalData), nil
+}
+
+// DecryptAes256Gcm 解密data并校验完整性，使用aes256-gcm算法,
+// aes密钥通过pbkdf2-hmac-sha256算法派生
+func DecryptAes256Gcm(data, secret, nonce, salt, additionalData []byte) (string, error) {
+	gcm, err := newAes256Gcm(secret, salt)
+	if err != nil {
+		return "", err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return "", errors.New(fmt.Sprintf("invalid nonce length:%d", len(nonce)))
+	}
+	plainText, err := gcm.Open(nil, nonce, data, additionalData)
+	if err != nil {
+		return "", err
+	}
+	return string(plainText), nil
+}
+
+func newAes256Gcm(secret, salt []byte) (cipher.AEAD, error) {
+	key := pbkdf2.Key(secret, salt, IterationCount, KeyLength, sha256.New)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
 }
 
 func pkcs5Padding(cipherText []byte, blockSize int) []byte {
@@ -50,7 +105,18 @@ func pkcs5Padding(cipherText []byte, blockSize int) []byte {
 	return append(cipherText, padText...)
 }
 
-func pkcs5UnPadding(origData []byte) []byte {
+func pkcs5UnPadding(origData []byte, blockSize int) ([]byte, error) {
+	if len(origData) == 0 {
+		return nil, errors.New("invalid pkcs5 padding data")
+	}
 	unpadding := int(origData[len(origData)-1])
-	return origData[:(len(origData) - unpadding)]
+	if unpadding == 0 || unpadding > blockSize || unpadding > len(origData) {
+		return nil, errors.New("invalid pkcs5 padding")
+	}
+	for _, b := range origData[len(origData)-unpadding:] {
+		if int(b) != unpadding {
+			return nil, errors.New("invalid pkcs5 padding")
+		}
+	}
+	return origData[:(len(origData) - unpadding)], nil
 }
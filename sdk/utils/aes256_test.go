@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAes256Gcm(t *testing.T) {
+	secret := bytes.Repeat([]byte{1}, RandomKeyLength)
+	nonce := bytes.Repeat([]byte{2}, GcmNonceLength)
+	salt := []byte("salt")
+	aad := []byte("secret\x00acscurrent")
+	encrypted, err := EncryptAes256Gcm([]byte("value"), secret, nonce, salt, aad)
+	assert.Nil(t, err)
+
+	plainText, err := DecryptAes256Gcm(encrypted, secret, nonce, salt, aad)
+	assert.Nil(t, err)
+	assert.Equal(t, "value", plainText)
+
+	// 附加认证数据不一致
+	_, err = DecryptAes256Gcm(encrypted, secret, nonce, salt, []byte("secret\x00acsprevious"))
+	assert.NotNil(t, err)
+	// 密文被篡改
+	tampered := append([]byte{}, encrypted...)
+	tampered[0] ^= 0xff
+	_, err = DecryptAes256Gcm(tampered, secret, nonce, salt, aad)
+	assert.NotNil(t, err)
+	// salt不一致
+	_, err = DecryptAes256Gcm(encrypted, secret, nonce, []byte("other"), aad)
+	assert.NotNil(t, err)
+	_, err = DecryptAes256Gcm(encrypted, secret, nonce[:4], salt, aad)
+	assert.NotNil(t, err)
+}
+
+func TestAes256Cbc(t *testing.T) {
+	secret := bytes.Repeat([]byte{1}, RandomKeyLength)
+	iv := bytes.Repeat([]byte{2}, IvLength)
+	salt := []byte("salt")
+	encrypted, err := EncryptAes256Cbc([]byte("value"), secret, iv, salt)
+	assert.Nil(t, err)
+	plainText, err := DecryptAes256Cbc(encrypted, secret, iv, salt)
+	assert.Nil(t, err)
+	assert.Equal(t, "value", plainText)
+
+	// 非法输入返回错误而不是panic
+	_, err = DecryptAes256Cbc(nil, secret, iv, salt)
+	assert.NotNil(t, err)
+	_, err = DecryptAes256Cbc(encrypted[:len(encrypted)-1], secret, iv, salt)
+	assert.NotNil(t, err)
+	_, err = DecryptAes256Cbc(encrypted, secret, iv[:8], salt)
+	assert.NotNil(t, err)
+	_, err = DecryptAes256Cbc(encrypted, secret, iv, []byte("other"))
+	assert.NotNil(t, err)
+}
+
+func TestPkcs5UnPadding(t *testing.T) {
+	data, err := pkcs5UnPadding([]byte{'a', 'b', 2, 2}, 16)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("ab"), data)
+	_, err = pkcs5UnPadding([]byte{}, 16)
+	assert.NotNil(t, err)
+	_, err = pkcs5UnPadding([]byte{'a', 0}, 16)
+	assert.NotNil(t, err)
+	_, err = pkcs5UnPadding([]byte{'a', 1, 3}, 16)
+	assert.NotNil(t, err)
+	_, err = pkcs5UnPadding([]byte{'a', 17}, 16)
+	assert.NotNil(t, err)
+}
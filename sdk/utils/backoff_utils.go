@@ -1,8 +1,10 @@
 package utils
 
 import (
-	sdkerr "github.com/aliyun/alibaba-cloud-sdk-go/sdk/errors"
+	"errors"
 	"strings"
+
+	sdkerr "github.com/aliyun/alibaba-cloud-sdk-go/sdk/errors"
 )
 
 const (
@@ -16,10 +18,19 @@ const (
 	InternalFailure = "InternalFailure"
 )
 
-// 根据Client异常判断是否进行规避重试
+// 根据Client异常判断是否进行规避重试，多地域错误中任一地域需要规避即返回true
 func JudgeNeedBackoff(err error) bool {
-	switch e := err.(type) {
-	case sdkerr.Error:
+	var multiErr *MultiRegionError
+	if errors.As(err, &multiErr) {
+		for _, regionErr := range multiErr.Errors {
+			if JudgeNeedBackoff(regionErr.Err) {
+				return true
+			}
+		}
+		return false
+	}
+	var e sdkerr.Error
+	if errors.As(err, &e) {
 		if RejectedThrottling == e.ErrorCode() || ServiceUnavailableTemporary == e.ErrorCode() || InternalFailure == e.ErrorCode() {
 			return true
 		}
@@ -27,10 +38,22 @@ func JudgeNeedBackoff(err error) bool {
 	return false
 }
 
-// 根据Client异常判断是否进行容灾重试
+// 根据Client异常判断是否进行容灾重试，多地域错误中任一地域需要容灾即返回true
 func JudgeNeedRecoveryException(err error) bool {
-	switch e := err.(type) {
-	case sdkerr.Error:
+	var multiErr *MultiRegionError
+	if errors.As(err, &multiErr) {
+		for _, regionErr := range multiErr.Errors {
+			if JudgeNeedRecoveryException(regionErr.Err) {
+				return true
+			}
+		}
+		return false
+	}
+	if errors.Is(err, ErrCircuitOpen) {
+		return true
+	}
+	var e sdkerr.Error
+	if errors.As(err, &e) {
 		if SdkReadTimeout == e.ErrorCode() || SdkServerUnreachable == e.ErrorCode() || SdkTimeoutError == e.ErrorCode() {
 			return true
 		}
@@ -38,6 +61,28 @@ func JudgeNeedRecoveryException(err error) bool {
 	return JudgeNeedBackoff(err)
 }
 
+// 判断错误码是否为指定的错误码之一，多地域错误中任一地域匹配即返回true
+func JudgeErrorCode(err error, errorCodes ...string) bool {
+	var multiErr *MultiRegionError
+	if errors.As(err, &multiErr) {
+		for _, regionErr := range multiErr.Errors {
+			if JudgeErrorCode(regionErr.Err, errorCodes...) {
+				return true
+			}
+		}
+		return false
+	}
+	var e sdkerr.Error
+	if errors.As(err, &e) {
+		for _, errorCode := range errorCodes {
+			if errorCode == e.ErrorCode() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func TransferErrorToClientError(err error) error {
 	if err != nil {
 		errStr := err.Error()
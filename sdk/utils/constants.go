@@ -19,6 +19,15 @@ const (
 	// 默认最大等待时间
 	DefaultCapacity = 10000
 
+	// 默认地域探测超时时间，单位ms
+	DefaultProbeTimeoutMills = 1000
+
+	// 默认地域探测采样次数
+	DefaultProbeSamples = 3
+
+	// 默认地域探测端口
+	DefaultProbePort = 443
+
 	// 环境变量cache_client_region_id key
 	EnvCacheClientRegionIdKey = "cache_client_region_id"
 
@@ -55,6 +64,9 @@ const (
 	// 欠费errorCode
 	ErrorCodeForbiddenInDebt = "Forbidden.InDebt"
 
+	// 凭据不存在errorCode
+	ErrorCodeForbiddenResourceNotFound = "Forbidden.ResourceNotFound"
+
 	// 模块名称
 	ModeName = "CacheClient"
 
@@ -103,6 +115,12 @@ const (
 	// 配置文件 secret_names key
 	PropertiesSecretNamesKey = "secret_names"
 
+	// 环境变量 secret_names key
+	EnvSecretNamesKey = "secret_names"
+
+	// 环境变量 文件缓存未指定KeyProvider时使用的主密钥 key
+	EnvCacheMasterKeyKey = "cache_client_master_key"
+
 	// 环境变量cache_client_dkms_config_info key
 	CacheClientDkmsConfigInfoKey = "cache_client_dkms_config_info"
 
@@ -8,12 +8,13 @@ import (
 	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/auth"
 	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/models"
 	"io/ioutil"
+	"strconv"
 	"strings"
 )
 
 func checkConfigParam(param, paramName string) error {
 	if param == "" {
-		return errors.New(fmt.Sprintf("credentials config missing required parameters[%s]", paramName))
+		return NewConfigError(paramName, fmt.Sprintf("credentials config missing required parameters[%s]", paramName), nil)
 	}
 	return nil
 }
@@ -42,7 +43,10 @@ func LoadCredentialsProperties(fileName string) (*models.CredentialsProperties,
 		if err != nil {
 			return nil, err
 		}
-		initSecretNames(configMap, credentialsProperties)
+		err = initSecretNames(configMap, credentialsProperties)
+		if err != nil {
+			return nil, err
+		}
 		return credentialsProperties, nil
 	}
 	return nil, nil
@@ -55,11 +59,60 @@ func initDefaultConfig(configMap map[string]string, credentialsProperties *model
 	return nil
 }
 
-func initSecretNames(configMap map[string]string, credentialsProperties *models.CredentialsProperties) {
-	secretNames := configMap[PropertiesSecretNamesKey]
-	if secretNames != "" {
-		credentialsProperties.SecretNameSlice = append(credentialsProperties.SecretNameSlice, strings.Split(secretNames, ",")...)
+func initSecretNames(configMap map[string]string, credentialsProperties *models.CredentialsProperties) error {
+	secretNames, secretTTLMap, err := ParseSecretNames(configMap[PropertiesSecretNamesKey])
+	if err != nil {
+		return NewConfigError(PropertiesSecretNamesKey, fmt.Sprintf("credentials config param[%s] is illegal, err:%v", PropertiesSecretNamesKey, err), err)
+	}
+	credentialsProperties.SecretNameSlice = append(credentialsProperties.SecretNameSlice, secretNames...)
+	credentialsProperties.SecretTTLMap = secretTTLMap
+	return nil
+}
+
+// LoadSecretNames 仅读取配置文件中的secret_names，填充SecretNameSlice及SecretTTLMap，文件不存在时返回nil
+func LoadSecretNames(fileName string) (*models.CredentialsProperties, error) {
+	if fileName == "" {
+		fileName = DefaultConfigName
+	}
+	configMap, err := LoadProperties(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if len(configMap) == 0 {
+		return nil, nil
+	}
+	credentialsProperties := &models.CredentialsProperties{}
+	err = initSecretNames(configMap, credentialsProperties)
+	if err != nil {
+		return nil, err
+	}
+	return credentialsProperties, nil
+}
+
+// ParseSecretNames 解析逗号分隔的凭据名称，凭据名称后可通过":"指定TTL，单位MS，如 secret1,secret2:60000
+func ParseSecretNames(secretNames string) ([]string, map[string]int64, error) {
+	var secretNameSlice []string
+	secretTTLMap := make(map[string]int64)
+	for _, item := range strings.Split(secretNames, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		secretName := item
+		if idx := strings.LastIndex(item, ":"); idx >= 0 {
+			secretName = strings.TrimSpace(item[:idx])
+			ttl, err := strconv.ParseInt(strings.TrimSpace(item[idx+1:]), 10, 64)
+			if err != nil || ttl <= 0 {
+				return nil, nil, errors.New(fmt.Sprintf("the ttl of secret[%s] must be a positive integer", secretName))
+			}
+			secretTTLMap[secretName] = ttl
+		}
+		if secretName == "" {
+			return nil, nil, errors.New(fmt.Sprintf("the secret name of [%s] must not be empty", item))
+		}
+		secretNameSlice = append(secretNameSlice, secretName)
 	}
+	return secretNameSlice, secretTTLMap, nil
 }
 
 func initSecretsRegions(configMap map[string]string, credentialsProperties *models.CredentialsProperties) error {
@@ -84,7 +137,7 @@ func initKmsRegions(configMap map[string]string, regionInfoSlice *[]*models.Regi
 	var regionInfos []map[string]interface{}
 	err := json.Unmarshal([]byte(regionInfoJson), &regionInfos)
 	if err != nil {
-		return errors.New(fmt.Sprintf("credentials config param[%s] is illegal, err:%v", EnvCacheClientRegionIdKey, err))
+		return NewConfigError(EnvCacheClientRegionIdKey, fmt.Sprintf("credentials config param[%s] is illegal, err:%v", EnvCacheClientRegionIdKey, err), err)
 	}
 	for _, regionInfoMap := range regionInfos {
 		regionId, err := ParseString(regionInfoMap[EnvRegionRegionIdNameKey])
@@ -117,11 +170,11 @@ func initDkmsInstances(configMap map[string]string, regionInfoSlice *[]*models.R
 	var dkmsConfigs []*models.DkmsConfig
 	err := json.Unmarshal([]byte(configJson), &dkmsConfigs)
 	if err != nil {
-		return errors.New(fmt.Sprintf("credentials config param[%s] is illegal, err:%v", CacheClientDkmsConfigInfoKey, err))
+		return NewConfigError(CacheClientDkmsConfigInfoKey, fmt.Sprintf("credentials config param[%s] is illegal, err:%v", CacheClientDkmsConfigInfoKey, err), err)
 	}
 	for _, dkmsConfig := range dkmsConfigs {
 		if tea.StringValue(dkmsConfig.RegionId) == "" || tea.StringValue(dkmsConfig.Endpoint) == "" || tea.StringValue(dkmsConfig.ClientKeyFile) == "" {
-			return errors.New("init properties fail, cause of cache_client_dkms_config_info param[regionId or endpoint or clientKeyFile] is empty")
+			return NewConfigError(CacheClientDkmsConfigInfoKey, "init properties fail, cause of cache_client_dkms_config_info param[regionId or endpoint or clientKeyFile] is empty", nil)
 		}
 		if dkmsConfig.CaFilePath != nil {
 			dkmsConfig.CaCert = tea.StringValue(dkmsConfig.CaFilePath)
@@ -129,7 +182,7 @@ func initDkmsInstances(configMap map[string]string, regionInfoSlice *[]*models.R
 		if !dkmsConfig.IgnoreSslCerts && !strings.Contains(dkmsConfig.CaCert, "-----BEGIN CERTIFICATE-----") {
 			caCert, err := ioutil.ReadFile(dkmsConfig.CaCert)
 			if err != nil {
-				return errors.New(fmt.Sprintf("dkms config CaCert[%s] is illegal, expect certificate pem or correct file path", dkmsConfig.CaCert))
+				return NewConfigError(CacheClientDkmsConfigInfoKey, fmt.Sprintf("dkms config CaCert[%s] is illegal, expect certificate pem or correct file path", dkmsConfig.CaCert), err)
 			}
 			dkmsConfig.CaCert = string(caCert)
 		}
@@ -234,7 +287,7 @@ func initCredentials(configMap map[string]string, credentialsProperties *models.
 			}
 			credential = models.NewClientKeyCredential(signer, cred)
 		default:
-			return errors.New(fmt.Sprintf("config param[%s] is illegal", EnvCredentialsTypeKey))
+			return NewConfigError(EnvCredentialsTypeKey, fmt.Sprintf("config param[%s] is illegal", EnvCredentialsTypeKey), nil)
 		}
 		credentialsProperties.Credential = credential
 	}
@@ -0,0 +1,283 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/models"
+
+	sdkerr "github.com/aliyun/alibaba-cloud-sdk-go/sdk/errors"
+)
+
+var (
+	// ErrClientClosed Client已关闭
+	ErrClientClosed = errors.New("the secret cache client is closed")
+
+	// ErrInvalidArgument 参数不合法
+	ErrInvalidArgument = errors.New("invalid argument")
+
+	// ErrInvalidConfig 配置文件或环境变量配置不合法
+	ErrInvalidConfig = errors.New("invalid config")
+
+	// ErrSecretNotFound 凭据不存在
+	ErrSecretNotFound = errors.New("the secret is not found")
+
+	// ErrSecretTypeMismatch 凭据数据类型与获取方式不匹配
+	ErrSecretTypeMismatch = errors.New("the secret data type mismatch")
+
+	// ErrThrottling KMS限流
+	ErrThrottling = errors.New("the request is throttled by kms")
+
+	// ErrServiceUnavailable KMS服务不可用或内部错误
+	ErrServiceUnavailable = errors.New("the kms service is unavailable")
+
+	// ErrServerUnreachable KMS服务连接超时或无法连接
+	ErrServerUnreachable = errors.New("the kms server is unreachable")
+
+	// ErrAllRegionsFailed 所有地域均调用失败
+	ErrAllRegionsFailed = errors.New("all regions failed")
+
+	// ErrCircuitOpen 地域熔断器处于打开状态
+	ErrCircuitOpen = errors.New("the region circuit breaker is open")
+
+	// ErrRetryBudgetExhausted 重试预算已耗尽
+	ErrRetryBudgetExhausted = errors.New("the retry budget is exhausted")
+
+	// ErrOperationNotSupported 地域对应的客户端不支持该操作，如专属KMS不支持凭据写操作
+	ErrOperationNotSupported = errors.New("the operation is not supported")
+
+	// ErrCacheIntegrity 缓存文件完整性校验失败，文件可能被篡改
+	ErrCacheIntegrity = errors.New("the cache file integrity check failed")
+)
+
+// KmsError 调用KMS失败的错误，Err为原始的sdkerr.Error
+type KmsError struct {
+	SecretName string
+	RegionInfo *models.RegionInfo
+	ErrorCode  string
+	RequestId  string
+	Err        error
+}
+
+// NewKmsError 将KMS返回的sdkerr.Error包装为*KmsError，其他错误原样返回
+func NewKmsError(secretName string, regionInfo *models.RegionInfo, err error) error {
+	var sdkErr sdkerr.Error
+	if !errors.As(err, &sdkErr) {
+		return err
+	}
+	kmsErr := &KmsError{
+		SecretName: secretName,
+		RegionInfo: regionInfo,
+		ErrorCode:  sdkErr.ErrorCode(),
+		Err:        err,
+	}
+	if e, ok := sdkErr.(interface{ RequestId() string }); ok {
+		kmsErr.RequestId = e.RequestId()
+	}
+	return kmsErr
+}
+
+func (e *KmsError) Error() string {
+	var regionId string
+	if e.RegionInfo != nil {
+		regionId = e.RegionInfo.RegionId
+	}
+	return fmt.Sprintf("secretName:%s, regionId:%s, requestId:%s, %v", e.SecretName, regionId, e.RequestId, e.Err)
+}
+
+func (e *KmsError) Unwrap() error {
+	return e.Err
+}
+
+// Is 根据KMS错误码匹配对应的错误类型
+func (e *KmsError) Is(target error) bool {
+	switch target {
+	case ErrSecretNotFound:
+		return e.ErrorCode == ErrorCodeForbiddenResourceNotFound
+	case ErrThrottling:
+		return e.ErrorCode == RejectedThrottling
+	case ErrServiceUnavailable:
+		return e.ErrorCode == ServiceUnavailableTemporary || e.ErrorCode == InternalFailure
+	case ErrServerUnreachable:
+		return e.ErrorCode == SdkReadTimeout || e.ErrorCode == SdkTimeoutError || e.ErrorCode == SdkServerUnreachable
+	}
+	return false
+}
+
+// RegionError 单个地域的调用错误
+type RegionError struct {
+	RegionInfo *models.RegionInfo
+	Err        error
+}
+
+func (e *RegionError) Error() string {
+	return fmt.Sprintf("regionInfo:%+v, %+v", e.RegionInfo, e.Err)
+}
+
+func (e *RegionError) Unwrap() error {
+	return e.Err
+}
+
+// MultiRegionError 所有地域均调用失败时各地域的错误
+type MultiRegionError struct {
+	SecretName string
+	Errors     []*RegionError
+}
+
+func (e *MultiRegionError) Error() string {
+	var errStr string
+	for _, err := range e.Errors {
+		errStr += fmt.Sprintf("%+v;", err)
+	}
+	return fmt.Sprintf("action:retryGetSecretValueTask:%s", errStr)
+}
+
+// Is 匹配ErrAllRegionsFailed或任一地域的错误
+func (e *MultiRegionError) Is(target error) bool {
+	if target == ErrAllRegionsFailed {
+		return true
+	}
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As 将第一个匹配target类型的地域错误赋值给target
+func (e *MultiRegionError) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// SecretError 与指定凭据相关的错误，Err为对应的错误类型
+type SecretError struct {
+	SecretName string
+	Message    string
+	Err        error
+}
+
+func (e *SecretError) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	return fmt.Sprintf("secretName:%s, %v", e.SecretName, e.Err)
+}
+
+func (e *SecretError) Unwrap() error {
+	return e.Err
+}
+
+// ConfigError 配置文件或环境变量中的参数错误
+type ConfigError struct {
+	Param   string
+	Message string
+	Err     error
+}
+
+func NewConfigError(param, message string, err error) *ConfigError {
+	return &ConfigError{Param: param, Message: message, Err: err}
+}
+
+func (e *ConfigError) Error() string {
+	return e.Message
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ConfigError) Is(target error) bool {
+	return target == ErrInvalidConfig
+}
+
+// BatchError 批量操作中各凭据对应的错误
+type BatchError struct {
+	Errors map[string]error
+}
+
+func (e *BatchError) Error() string {
+	secretNames := make([]string, 0, len(e.Errors))
+	for secretName := range e.Errors {
+		secretNames = append(secretNames, secretName)
+	}
+	sort.Strings(secretNames)
+	var errStr string
+	for _, secretName := range secretNames {
+		errStr += fmt.Sprintf("secretName[%s]:%+v;", secretName, e.Errors[secretName])
+	}
+	return errStr
+}
+
+// Is 任一凭据的错误匹配target即返回true
+func (e *BatchError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As 将第一个匹配target类型的凭据错误赋值给target
+func (e *BatchError) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// MultiError 多个操作的错误，如依次关闭多个组件时的错误
+type MultiError struct {
+	Errors []error
+}
+
+// NewMultiError 忽略nil错误，没有错误时返回nil
+func NewMultiError(errs ...error) error {
+	var nonNilErrs []error
+	for _, err := range errs {
+		if err != nil {
+			nonNilErrs = append(nonNilErrs, err)
+		}
+	}
+	if len(nonNilErrs) == 0 {
+		return nil
+	}
+	return &MultiError{Errors: nonNilErrs}
+}
+
+func (e *MultiError) Error() string {
+	var errStr string
+	for _, err := range e.Errors {
+		errStr += fmt.Sprintf("%+v;", err)
+	}
+	return errStr
+}
+
+// Is 任一错误匹配target即返回true
+func (e *MultiError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As 将第一个匹配target类型的错误赋值给target
+func (e *MultiError) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
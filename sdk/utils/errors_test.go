@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/models"
+
+	sdkerr "github.com/aliyun/alibaba-cloud-sdk-go/sdk/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewKmsError(t *testing.T) {
+	regionInfo := &models.RegionInfo{RegionId: "cn-hangzhou"}
+	err := NewKmsError("cache_client", regionInfo, sdkerr.NewServerError(404, `{"Code":"Forbidden.ResourceNotFound","RequestId":"request-id"}`, ""))
+
+	var kmsErr *KmsError
+	assert.True(t, errors.As(err, &kmsErr))
+	assert.Equal(t, "cache_client", kmsErr.SecretName)
+	assert.Equal(t, regionInfo, kmsErr.RegionInfo)
+	assert.Equal(t, ErrorCodeForbiddenResourceNotFound, kmsErr.ErrorCode)
+	assert.Equal(t, "request-id", kmsErr.RequestId)
+	assert.True(t, errors.Is(err, ErrSecretNotFound))
+	assert.False(t, errors.Is(err, ErrThrottling))
+
+	var sdkErr sdkerr.Error
+	assert.True(t, errors.As(err, &sdkErr))
+	assert.Equal(t, ErrorCodeForbiddenResourceNotFound, sdkErr.ErrorCode())
+
+	err = NewKmsError("cache_client", regionInfo, sdkerr.NewClientError(SdkTimeoutError, "timeout", errors.New("i/o timeout")))
+	assert.True(t, errors.Is(err, ErrServerUnreachable))
+	assert.True(t, JudgeNeedRecoveryException(err))
+	assert.False(t, JudgeNeedBackoff(err))
+
+	err = NewKmsError("cache_client", regionInfo, sdkerr.NewServerError(400, `{"Code":"Rejected.Throttling"}`, ""))
+	assert.True(t, errors.Is(err, ErrThrottling))
+	assert.True(t, JudgeNeedBackoff(err))
+
+	plainErr := errors.New("plain")
+	assert.Equal(t, plainErr, NewKmsError("cache_client", regionInfo, plainErr))
+}
+
+func TestConfigError(t *testing.T) {
+	_, _, err := ParseSecretNames("cache_client:-1")
+	assert.NotNil(t, err)
+	err = initSecretNames(map[string]string{PropertiesSecretNamesKey: "cache_client:-1"}, &models.CredentialsProperties{})
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+	var configErr *ConfigError
+	assert.True(t, errors.As(err, &configErr))
+	assert.Equal(t, PropertiesSecretNamesKey, configErr.Param)
+}
+
+func TestMultiRegionError(t *testing.T) {
+	regionInfo1 := &models.RegionInfo{RegionId: "cn-hangzhou"}
+	regionInfo2 := &models.RegionInfo{RegionId: "cn-shanghai"}
+	err := error(&MultiRegionError{
+		SecretName: "cache_client",
+		Errors: []*RegionError{
+			{RegionInfo: regionInfo1, Err: NewKmsError("cache_client", regionInfo1, sdkerr.NewServerError(403, `{"Code":"Forbidden.InDebt"}`, ""))},
+			{RegionInfo: regionInfo2, Err: NewKmsError("cache_client", regionInfo2, sdkerr.NewClientError(SdkServerUnreachable, "unreachable", errors.New("no such host")))},
+		},
+	})
+	assert.True(t, errors.Is(err, ErrAllRegionsFailed))
+	assert.True(t, errors.Is(err, ErrServerUnreachable))
+	assert.False(t, errors.Is(err, ErrSecretNotFound))
+	assert.True(t, JudgeNeedRecoveryException(err))
+	assert.False(t, JudgeNeedBackoff(err))
+	assert.True(t, JudgeErrorCode(err, ErrorCodeForbiddenInDebt))
+	assert.False(t, JudgeErrorCode(err, ErrorCodeForbiddenInDebtOverDue))
+
+	var regionErr *RegionError
+	assert.True(t, errors.As(err, &regionErr))
+	assert.Equal(t, regionInfo1, regionErr.RegionInfo)
+	var kmsErr *KmsError
+	assert.True(t, errors.As(err, &kmsErr))
+	assert.Equal(t, ErrorCodeForbiddenInDebt, kmsErr.ErrorCode)
+}
+
+func TestMultiError(t *testing.T) {
+	assert.Nil(t, NewMultiError())
+	assert.Nil(t, NewMultiError(nil, nil))
+
+	configErr := NewConfigError("param", "invalid param", nil)
+	err := NewMultiError(nil, ErrClientClosed, configErr)
+	var multiErr *MultiError
+	assert.True(t, errors.As(err, &multiErr))
+	assert.Equal(t, 2, len(multiErr.Errors))
+	assert.True(t, errors.Is(err, ErrClientClosed))
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+	assert.False(t, errors.Is(err, ErrSecretNotFound))
+	var target *ConfigError
+	assert.True(t, errors.As(err, &target))
+	assert.Equal(t, "param", target.Param)
+	assert.Equal(t, ErrClientClosed.Error()+";invalid param;", err.Error())
+}
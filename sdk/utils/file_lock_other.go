@@ -0,0 +1,21 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !windows
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!windows
+
+package utils
+
+import (
+	"os"
+)
+
+// 当前平台不支持文件锁，多进程共享缓存目录时依赖重命名的原子性
+func lockFile(f *os.File) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
+
+func syncDir(dirPath string) error {
+	return nil
+}
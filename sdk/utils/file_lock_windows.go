@@ -0,0 +1,41 @@
+//go:build windows
+// +build windows
+
+package utils
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const lockFileExclusiveLock = 0x2
+
+var (
+	modKernel32      = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = modKernel32.NewProc("LockFileEx")
+	procUnlockFileEx = modKernel32.NewProc("UnlockFileEx")
+)
+
+func lockFile(f *os.File) error {
+	ol := new(syscall.Overlapped)
+	r1, _, e1 := procLockFileEx.Call(f.Fd(), lockFileExclusiveLock, 0, 1, 0, uintptr(unsafe.Pointer(ol)))
+	if r1 == 0 {
+		return e1
+	}
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	ol := new(syscall.Overlapped)
+	r1, _, e1 := procUnlockFileEx.Call(f.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(ol)))
+	if r1 == 0 {
+		return e1
+	}
+	return nil
+}
+
+// windows不支持目录落盘
+func syncDir(dirPath string) error {
+	return nil
+}
@@ -2,9 +2,25 @@ package utils
 
 import (
 	"encoding/json"
-	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/logger"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/aliyun/aliyun-secretsmanager-client-go/sdk/logger"
+)
+
+const (
+	// 缓存目录权限
+	CacheDirPerm = 0700
+
+	// 缓存文件权限
+	CacheFilePerm = 0600
+
+	// 缓存目录下的文件锁名称
+	LockFileName = ".lock"
 )
 
 func ReadJsonObject(filePath, fileName string, out interface{}) error {
@@ -29,34 +45,104 @@ func ReadJsonObject(filePath, fileName string, out interface{}) error {
 	return nil
 }
 
+// WriteJsonObject 原子写入json文件，先写入同目录下的临时文件并落盘，再重命名覆盖目标文件,
+// 多进程共享同一目录时通过文件锁串行写入
 func WriteJsonObject(filePath, fileName string, in interface{}) error {
-	if !FileExists(filePath, "") {
-		err := os.MkdirAll(filePath, os.ModeDir|os.ModePerm)
-		if err != nil {
-			return err
-		}
+	byteVale, err := json.Marshal(in)
+	if err != nil {
+		return err
 	}
-	jsonFile, err := os.OpenFile(filePath+string(os.PathSeparator)+fileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	err = ensureCacheDir(filePath)
 	if err != nil {
 		return err
 	}
-	defer func() {
-		e := jsonFile.Close()
-		if e != nil {
+	lck, err := acquireFileLock(filePath)
+	if err != nil {
+		return err
+	}
+	defer releaseFileLock(lck)
+	// ioutil.TempFile创建的文件权限为0600
+	tmpFile, err := ioutil.TempFile(filePath, "."+fileName+".tmp")
+	if err != nil {
+		return err
+	}
+	tmpFileName := tmpFile.Name()
+	_, err = tmpFile.Write(byteVale)
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	if e := tmpFile.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(tmpFileName, filepath.Join(filePath, fileName))
+	}
+	if err != nil {
+		if e := os.Remove(tmpFileName); e != nil && !os.IsNotExist(e) {
 			logger.GetCommonLogger(ModeName).Errorf(e.Error())
 		}
-	}()
-	byteVale, err := json.Marshal(in)
+		return err
+	}
+	if e := syncDir(filePath); e != nil {
+		logger.GetCommonLogger(ModeName).Errorf(e.Error())
+	}
+	return nil
+}
+
+// 创建缓存目录，MkdirAll不修改已存在目录的权限，因此对已存在的目录收紧权限
+func ensureCacheDir(filePath string) error {
+	err := os.MkdirAll(filePath, CacheDirPerm)
 	if err != nil {
 		return err
 	}
-	_, err = jsonFile.Write(byteVale)
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	dirInfo, err := os.Stat(filePath)
 	if err != nil {
 		return err
 	}
+	if dirInfo.Mode().Perm() != CacheDirPerm {
+		return os.Chmod(filePath, CacheDirPerm)
+	}
+	return nil
+}
+
+// ValidateRelativePath 校验path为相对路径且不包含空、.及..路径元素，防止拼接后访问目标目录之外的文件
+func ValidateRelativePath(path string) error {
+	if path == "" || filepath.IsAbs(path) || filepath.VolumeName(path) != "" || strings.ContainsRune(path, 0) {
+		return fmt.Errorf("invalid path [%s]: %w", path, ErrInvalidArgument)
+	}
+	for _, element := range strings.Split(strings.ReplaceAll(path, "\\", "/"), "/") {
+		if element == "" || element == "." || element == ".." {
+			return fmt.Errorf("invalid path [%s]: %w", path, ErrInvalidArgument)
+		}
+	}
 	return nil
 }
 
+// 获取目录下的写锁
+func acquireFileLock(filePath string) (*os.File, error) {
+	lck, err := os.OpenFile(filepath.Join(filePath, LockFileName), os.O_RDWR|os.O_CREATE, CacheFilePerm)
+	if err != nil {
+		return nil, err
+	}
+	if err = lockFile(lck); err != nil {
+		lck.Close()
+		return nil, err
+	}
+	return lck, nil
+}
+
+func releaseFileLock(lck *os.File) {
+	if err := unlockFile(lck); err != nil {
+		logger.GetCommonLogger(ModeName).Errorf(err.Error())
+	}
+	if err := lck.Close(); err != nil {
+		logger.GetCommonLogger(ModeName).Errorf(err.Error())
+	}
+}
+
 func FileExists(filePath, fileName string) bool {
 	if _, err := os.Stat(filePath + string(os.PathSeparator) + fileName); err != nil {
 		if os.IsNotExist(err) {
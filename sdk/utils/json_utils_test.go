@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type jsonObject struct {
+	Name  string
+	Value string
+}
+
+func TestWriteJsonObject(t *testing.T) {
+	tempPath, err := ioutil.TempDir("", "json_utils")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tempPath)
+	filePath := filepath.Join(tempPath, "secret")
+
+	assert.Nil(t, WriteJsonObject(filePath, "stage.json", &jsonObject{Name: "secret", Value: "v1"}))
+	assert.Nil(t, WriteJsonObject(filePath, "stage.json", &jsonObject{Name: "secret", Value: "v2"}))
+	var out jsonObject
+	assert.Nil(t, ReadJsonObject(filePath, "stage.json", &out))
+	assert.Equal(t, "v2", out.Value)
+
+	// 不残留临时文件
+	fileInfos, err := ioutil.ReadDir(filePath)
+	assert.Nil(t, err)
+	var fileNames []string
+	for _, fileInfo := range fileInfos {
+		fileNames = append(fileNames, fileInfo.Name())
+	}
+	assert.ElementsMatch(t, []string{"stage.json", LockFileName}, fileNames)
+
+	if runtime.GOOS != "windows" {
+		fileInfo, err := os.Stat(filepath.Join(filePath, "stage.json"))
+		assert.Nil(t, err)
+		assert.Equal(t, os.FileMode(CacheFilePerm), fileInfo.Mode().Perm())
+		dirInfo, err := os.Stat(filePath)
+		assert.Nil(t, err)
+		assert.Equal(t, os.FileMode(CacheDirPerm), dirInfo.Mode().Perm())
+	}
+}
+
+func TestWriteJsonObject_ExistingDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file mode is not supported on windows")
+	}
+	tempPath, err := ioutil.TempDir("", "json_utils")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tempPath)
+	filePath := filepath.Join(tempPath, "secret")
+	assert.Nil(t, os.Mkdir(filePath, 0755))
+	assert.Nil(t, os.Chmod(filePath, 0755))
+
+	// 已存在的缓存目录权限被收紧
+	assert.Nil(t, WriteJsonObject(filePath, "stage.json", &jsonObject{Name: "secret", Value: "v1"}))
+	dirInfo, err := os.Stat(filePath)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(CacheDirPerm), dirInfo.Mode().Perm())
+}
+
+func TestWriteJsonObject_Concurrent(t *testing.T) {
+	tempPath, err := ioutil.TempDir("", "json_utils")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tempPath)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.Nil(t, WriteJsonObject(tempPath, "stage.json", &jsonObject{Name: "secret", Value: strconv.Itoa(i)}))
+		}(i)
+	}
+	wg.Wait()
+	var out jsonObject
+	assert.Nil(t, ReadJsonObject(tempPath, "stage.json", &out))
+	assert.Equal(t, "secret", out.Name)
+}
+
+func TestValidateRelativePath(t *testing.T) {
+	for _, path := range []string{"secret", "app/secret", "secret.v1", "..secret"} {
+		assert.Nil(t, ValidateRelativePath(path), path)
+	}
+	for _, path := range []string{"", ".", "..", "../secret", "app/../../secret", "/etc/passwd", "app//secret", "app/", `..\secret`, "secret\x00"} {
+		err := ValidateRelativePath(path)
+		assert.True(t, errors.Is(err, ErrInvalidArgument), path)
+	}
+}
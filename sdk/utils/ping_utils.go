@@ -8,6 +8,7 @@ import (
 	"strings"
 )
 
+// Deprecated: 依赖系统ping命令且ICMP常被禁用，地域探测请使用service.RegionProber
 func Ping(host string) float64 {
 	var args string
 	var pattern string